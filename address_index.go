@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+
+	"github.com/boltdb/bolt"
+)
+
+const addrIndexBucket = "addrindex"
+
+// AddressTx is a transaction of the main chain seen from one address
+// Received is what its outputs pay the address, Sent what its inputs spend from the address.
+// Counterparties are the addresses of the recipients of a payment, or of the senders of an income,
+// Balance is the balance of the address once the transaction is confirmed
+type AddressTx struct {
+	TxID           []byte
+	BlockHash      []byte
+	Height         int
+	Coinbase       bool
+	Received       int
+	Sent           int
+	Counterparties [][]byte
+	Balance        int
+}
+
+// HasAddrIndex tells whether the address index is enabled, it is kept up to date with the main chain once built
+func (bc *Blockchain) HasAddrIndex() bool {
+	return bc.hasIndex(addrIndexBucket)
+}
+
+// ReindexAddresses builds the address index from the blocks of the main chain, enabling it if needed
+func (bc *Blockchain) ReindexAddresses() error {
+	return bc.rebuildIndex(addrIndexBucket, indexAddresses)
+}
+
+// AddressHistory returns the transactions of the main chain paying or spending from pubKeyHash, oldest first
+// The address index is used when enabled, otherwise every block of the main chain is scanned
+func (bc *Blockchain) AddressHistory(pubKeyHash []byte) ([]AddressTx, error) {
+	var history []AddressTx
+	var blocks []*Block
+	var positions []int
+
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(blocksBucket))
+
+		if a := tx.Bucket([]byte(addrIndexBucket)); a != nil {
+			txs := a.Bucket(pubKeyHash)
+			if txs == nil {
+				return nil
+			}
+			// keys are the height and position of the transaction, so the cursor goes through them in order
+			c := txs.Cursor()
+			for k, blockHash := c.First(); k != nil; k, blockHash = c.Next() {
+				blocks = append(blocks, DeserializeBlock(b.Get(blockHash)))
+				positions = append(positions, int(binary.BigEndian.Uint64(k[8:])))
+			}
+			return nil
+		}
+
+		c := tx.Bucket([]byte(heightsBucket)).Cursor()
+		for _, blockHash := c.First(); blockHash != nil; _, blockHash = c.Next() {
+			block := DeserializeBlock(b.Get(blockHash))
+			for i, t := range block.Transactions {
+				if usesAddress(t, pubKeyHash) {
+					blocks = append(blocks, block)
+					positions = append(positions, i)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	balance := 0
+	for i, block := range blocks {
+		tx := block.Transactions[positions[i]]
+		entry := AddressTx{
+			TxID:      tx.ID,
+			BlockHash: block.Hash,
+			Height:    block.Height,
+			Coinbase:  tx.isCoinbase(),
+		}
+
+		var senders [][]byte
+		if !tx.isCoinbase() {
+			prevTxs, err := bc.findPrevTransactionsFrom(block.Hash, tx)
+			if err != nil {
+				return nil, err
+			}
+			for _, vin := range tx.Vin {
+				if vin.UsesKey(pubKeyHash) {
+					entry.Sent += prevTxs[hex.EncodeToString(vin.Txid)].Vout[vin.Vout].Value
+				} else {
+					senders = appendHash(senders, vin.Address())
+				}
+			}
+		}
+
+		var recipients [][]byte
+		for _, out := range tx.Vout {
+			if out.IsLockedWithKey(pubKeyHash) {
+				entry.Received += out.Value
+			} else {
+				recipients = appendHash(recipients, out.Address())
+			}
+		}
+
+		entry.Counterparties = senders
+		if entry.Sent > 0 {
+			entry.Counterparties = recipients
+		}
+
+		balance += entry.Received - entry.Sent
+		entry.Balance = balance
+		history = append(history, entry)
+	}
+
+	return history, nil
+}
+
+// HistoryPage returns count transactions at most of history after skipping the skip most recent ones, along with
+// the position of the first one in history. Pages go back from the most recent transaction, each one oldest first
+func HistoryPage(history []AddressTx, count, skip int) ([]AddressTx, int) {
+	end := len(history) - skip
+	if end < 0 {
+		end = 0
+	}
+	start := end - count
+	if start < 0 {
+		start = 0
+	}
+	return history[start:end], start
+}
+
+// UsedPubKeyHashes returns the hex encoded public key hashes paid or spent from in the main chain
+// The address index is used when enabled, otherwise every block of the main chain is scanned
+func (bc *Blockchain) UsedPubKeyHashes() (map[string]bool, error) {
+	used := make(map[string]bool)
+
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		if a := tx.Bucket([]byte(addrIndexBucket)); a != nil {
+			// every address of the index has a bucket of its transactions
+			return a.ForEach(func(pubKeyHash, _ []byte) error {
+				used[hex.EncodeToString(pubKeyHash)] = true
+				return nil
+			})
+		}
+
+		b := tx.Bucket([]byte(blocksBucket))
+		c := tx.Bucket([]byte(heightsBucket)).Cursor()
+		for _, blockHash := c.First(); blockHash != nil; _, blockHash = c.Next() {
+			for _, t := range DeserializeBlock(b.Get(blockHash)).Transactions {
+				for _, pubKeyHash := range txAddresses(t) {
+					used[hex.EncodeToString(pubKeyHash)] = true
+				}
+			}
+		}
+		return nil
+	})
+
+	return used, err
+}
+
+// indexAddresses adds the transactions of a block joining the main chain to the history of their addresses
+func indexAddresses(a *bolt.Bucket, block *Block) error {
+	for i, tx := range block.Transactions {
+		for _, pubKeyHash := range txAddresses(tx) {
+			txs, err := a.CreateBucketIfNotExists(pubKeyHash)
+			if err != nil {
+				return err
+			}
+			err = txs.Put(addrIndexKey(block.Height, i), block.Hash)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// unindexAddresses removes the transactions of a block leaving the main chain from the history of their addresses
+func unindexAddresses(a *bolt.Bucket, block *Block) error {
+	for i, tx := range block.Transactions {
+		for _, pubKeyHash := range txAddresses(tx) {
+			txs := a.Bucket(pubKeyHash)
+			if txs == nil {
+				continue
+			}
+			err := txs.Delete(addrIndexKey(block.Height, i))
+			if err != nil {
+				return err
+			}
+			if k, _ := txs.Cursor().First(); k == nil {
+				err = a.DeleteBucket(pubKeyHash)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// addrIndexKey orders the transactions of an address by height, then by position in the block
+func addrIndexKey(height, position int) []byte {
+	return append(IntToHex(int64(height)), IntToHex(int64(position))...)
+}
+
+// txAddresses returns the hashes of the keys and multisig policies a transaction spends from or pays, without duplicates
+func txAddresses(tx *Transaction) [][]byte {
+	var hashes [][]byte
+
+	if !tx.isCoinbase() {
+		for _, vin := range tx.Vin {
+			hashes = appendHash(hashes, vin.LockHash())
+		}
+	}
+	for _, out := range tx.Vout {
+		hashes = appendHash(hashes, out.PubKeyHash)
+	}
+
+	return hashes
+}
+
+// usesAddress tells whether a transaction spends from or pays pubKeyHash
+func usesAddress(tx *Transaction, pubKeyHash []byte) bool {
+	for _, hash := range txAddresses(tx) {
+		if bytes.Compare(hash, pubKeyHash) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// appendHash appends hash to hashes unless it is already there, or nil as for the scripts, which have no address
+func appendHash(hashes [][]byte, hash []byte) [][]byte {
+	if hash == nil {
+		return hashes
+	}
+	for _, h := range hashes {
+		if bytes.Compare(h, hash) == 0 {
+			return hashes
+		}
+	}
+	return append(hashes, hash)
+}
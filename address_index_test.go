@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/boltdb/bolt"
+)
+
+func TestAddressHistory(t *testing.T) {
+	defer useTestDir(t)()
+
+	alice := NewWallet()
+	bob := NewWallet()
+	aliceAddress := string(alice.GetAddress())
+	bobAddress := string(bob.GetAddress())
+	bc, err := CreateBlockchain(aliceAddress, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.Close()
+
+	err = bc.ReindexAddresses()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// alice pays bob twice, then bob pays some back
+	UTXOSet := UTXOSet{bc}
+	first := NewUTXOTransaction(alice, bobAddress, 3, 1, &UTXOSet)
+	bc.MineBlock([]*Transaction{NewRewardTX(bobAddress, "", subsidy+1), first})
+	second := NewUTXOTransaction(alice, bobAddress, 2, 0, &UTXOSet)
+	bc.MineBlock([]*Transaction{NewCoinbaseTX(bobAddress, ""), second})
+	back := NewUTXOTransaction(bob, aliceAddress, 5, 0, &UTXOSet)
+	bc.MineBlock([]*Transaction{NewCoinbaseTX(bobAddress, ""), back})
+
+	history, err := bc.AddressHistory(HashPubKey(alice.PublicKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		height, received, sent, balance int
+	}{
+		{0, subsidy, 0, 10},
+		{1, 6, 10, 6},
+		{2, 4, 6, 4},
+		{3, 5, 0, 9},
+	}
+	if len(history) != len(want) {
+		t.Fatalf("alice has %d transactions, want %d", len(history), len(want))
+	}
+	for i, w := range want {
+		got := history[i]
+		if got.Height != w.height || got.Received != w.received || got.Sent != w.sent || got.Balance != w.balance {
+			t.Errorf("transaction %d = height %d, +%d -%d, balance %d, want %v", i, got.Height, got.Received, got.Sent, got.Balance, w)
+		}
+	}
+	if len(history[1].Counterparties) != 1 || !bytes.Equal(history[1].Counterparties[0], bob.GetAddress()) {
+		t.Errorf("counterparties of the payment = %s, want bob", history[1].Counterparties)
+	}
+	if !history[0].Coinbase || len(history[3].Counterparties) != 1 || !bytes.Equal(history[3].Counterparties[0], bob.GetAddress()) {
+		t.Errorf("unexpected sources of income %v and %s", history[0].Coinbase, history[3].Counterparties)
+	}
+
+	// the index gives the same history as scanning the chain
+	indexed, err := bc.AddressHistory(HashPubKey(bob.PublicKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = bc.db.Update(func(tx *bolt.Tx) error {
+		return tx.DeleteBucket([]byte(addrIndexBucket))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	scanned, err := bc.AddressHistory(HashPubKey(bob.PublicKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(indexed) != 6 || !reflect.DeepEqual(indexed, scanned) {
+		t.Errorf("indexed history %v, scanned history %v", indexed, scanned)
+	}
+}
+
+func TestAddressHistoryPages(t *testing.T) {
+	defer useTestDir(t)()
+
+	alice := NewWallet()
+	aliceAddress := string(alice.GetAddress())
+	bobAddress := string(NewWallet().GetAddress())
+	bc, err := CreateBlockchain(aliceAddress, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.Close()
+
+	// every payment of alice spends her whole balance and pays her the change
+	UTXOSet := UTXOSet{bc}
+	for i := 0; i < 4; i++ {
+		tx := NewUTXOTransaction(alice, bobAddress, 1, 1, &UTXOSet)
+		bc.MineBlock([]*Transaction{NewCoinbaseTX(bobAddress, ""), tx})
+	}
+
+	history, err := bc.AddressHistory(HashPubKey(alice.PublicKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 5 {
+		t.Fatalf("alice has %d transactions, want 5", len(history))
+	}
+	// a send with change shows both what it spends and the change it receives
+	for i, entry := range history[1:] {
+		balance := subsidy - 2*(i+1)
+		if entry.Sent != balance+2 || entry.Received != balance || entry.Balance != balance {
+			t.Errorf("payment %d = +%d -%d, balance %d, want +%d -%d, balance %d", i, entry.Received, entry.Sent, entry.Balance, balance, balance+2, balance)
+		}
+	}
+
+	tests := []struct {
+		count, skip int
+		heights     []int
+		start       int
+	}{
+		{2, 0, []int{3, 4}, 3},
+		{2, 2, []int{1, 2}, 1},
+		{2, 4, []int{0}, 0},
+		{10, 0, []int{0, 1, 2, 3, 4}, 0},
+		{2, 5, nil, 0},
+		{2, 9, nil, 0},
+	}
+	for _, test := range tests {
+		page, start := HistoryPage(history, test.count, test.skip)
+		var heights []int
+		for _, entry := range page {
+			heights = append(heights, entry.Height)
+		}
+		if start != test.start || !reflect.DeepEqual(heights, test.heights) {
+			t.Errorf("-count %d -skip %d: heights %v from %d, want %v from %d", test.count, test.skip, heights, start, test.heights, test.start)
+		}
+	}
+
+	// the running balance is the one of the whole history, whatever the page
+	page, _ := HistoryPage(history, 1, 2)
+	if page[0].Balance != subsidy-4 {
+		t.Errorf("balance on the page = %d, want %d", page[0].Balance, subsidy-4)
+	}
+}
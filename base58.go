@@ -23,7 +23,8 @@ func Base58Encode(input []byte) []byte {
 	}
 
 	ReverseBytes(result)
-	for b := range input {
+	// every leading zero byte is encoded as the first character of the alphabet
+	for _, b := range input {
 		if b == 0x00 {
 			result = append([]byte{b58Alphabet[0]}, result...)
 		} else {
@@ -39,9 +40,11 @@ func Base58Decode(input []byte) []byte {
 	result := big.NewInt(0)
 	zeroBytes := 0
 
-	for b := range input {
-		if b == 0x00 {
+	for _, b := range input {
+		if b == b58Alphabet[0] {
 			zeroBytes++
+		} else {
+			break
 		}
 	}
 
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBase58KeepsLeadingZeros(t *testing.T) {
+	for _, input := range [][]byte{
+		{0x00, 0x01, 0x02},
+		{0x00, 0x00, 0x00, 0xff},
+		{0x01, 0x00},
+	} {
+		encoded := Base58Encode(input)
+		if decoded := Base58Decode(encoded); !bytes.Equal(decoded, input) {
+			t.Errorf("Base58Decode(%s) = %x, want %x", encoded, decoded, input)
+		}
+	}
+	if encoded := Base58Encode([]byte{0x00, 0x00, 0x01}); string(encoded) != "112" {
+		t.Errorf("Base58Encode(000001) = %s, want 112", encoded)
+	}
+}
@@ -2,9 +2,9 @@ package main
 
 import (
 	"bytes"
-	"crypto/sha256"
 	"encoding/gob"
 	"log"
+	"math/big"
 	"time"
 )
 
@@ -16,6 +16,8 @@ type Block struct {
 	PrevBlockHash []byte
 	Hash          []byte
 	Nonce         int
+	Target        []byte // the proof of work target the hash is below, as a big-endian integer
+	Height        int    // the number of blocks before this one, the genesis block has height 0
 }
 
 // Serialize convert blocks into bytes
@@ -29,21 +31,57 @@ func (b *Block) Serialize() []byte {
 	return result.Bytes()
 }
 
-// HashTransactions hashes Transactions field within a Block and return it as a byte array
+// HashTransactions returns the merkle root of the IDs of the transactions within a Block
+// A block without transactions, which is invalid, has no root and nil is returned
 func (b *Block) HashTransactions() []byte {
-	var txHashes [][]byte
-	var txHash [32]byte
+	tree, err := b.merkleTree()
+	if err != nil {
+		return nil
+	}
+	return tree.RootNode.Data
+}
+
+// MerkleProof returns a proof that the transaction with txID is included in the block
+// The proof can be checked against the block's HashTransactions with MerkleProof.Verify
+func (b *Block) MerkleProof(txID []byte) (*MerkleProof, error) {
+	tree, err := b.merkleTree()
+	if err != nil {
+		return nil, err
+	}
+	return tree.Proof(txID)
+}
+
+// DuplicateTransaction returns the first transaction ID repeated in the block, nil if there is none
+// A block repeating its last transactions has the merkle root, thus the hash, of the block without them
+func (b *Block) DuplicateTransaction() []byte {
+	seen := make(map[string]bool)
 
 	for _, tx := range b.Transactions {
-		txHashes = append(txHashes, tx.ID)
+		if seen[string(tx.ID)] {
+			return tx.ID
+		}
+		seen[string(tx.ID)] = true
 	}
-	txHash = sha256.Sum256(bytes.Join(txHashes, []byte{}))
-	return txHash[:]
+	return nil
+}
+
+func (b *Block) merkleTree() (*MerkleTree, error) {
+	var txIDs [][]byte
+
+	for _, tx := range b.Transactions {
+		txIDs = append(txIDs, tx.ID)
+	}
+	return NewMerkleTree(txIDs)
+}
+
+// NewBlock is used to create new block in the block chain, it is mined with the given target
+func NewBlock(transactions []*Transaction, prevBlockHash []byte, height int, target *big.Int) *Block {
+	return newBlockAt(time.Now().Unix(), transactions, prevBlockHash, height, target)
 }
 
-// NewBlock is used to create new block in the block chain
-func NewBlock(transactions []*Transaction, prevBlockHash []byte) *Block {
-	block := &Block{time.Now().Unix(), transactions, prevBlockHash, []byte{}, 0}
+// newBlockAt creates a block like NewBlock, with the given timestamp
+func newBlockAt(timestamp int64, transactions []*Transaction, prevBlockHash []byte, height int, target *big.Int) *Block {
+	block := &Block{timestamp, transactions, prevBlockHash, []byte{}, 0, target.Bytes(), height}
 	pow := NewProofOfWork(block)
 	nonce, hash := pow.Run()
 
@@ -55,7 +93,7 @@ func NewBlock(transactions []*Transaction, prevBlockHash []byte) *Block {
 
 // NewGenesisBlock create the genesis block(the first block) of the blockchain
 func NewGenesisBlock(coinbase *Transaction) *Block {
-	return NewBlock([]*Transaction{coinbase}, []byte{})
+	return NewBlock([]*Transaction{coinbase}, []byte{}, 0, maxTarget())
 }
 
 // DeserializeBlock convert bytes back into a block
@@ -8,12 +8,69 @@ import (
 	"fmt"
 	"github.com/boltdb/bolt"
 	"log"
+	"math/big"
 	"os"
+	"time"
 )
 
+// genesisCoinbaseData is the coinbase data of the genesis block when createblockchain isn't given any
 const genesisCoinbaseData = "Make Australian Great Again"
 const blocksBucket = "blocks"
+const metaBucket = "meta"
+const heightsBucket = "heights"
+const chainWorkBucket = "chainwork"
+const orphansBucket = "orphans"
 const dbFile = "blockchain.db"
+const nodeDBFile = "blockchain_%s.db"
+
+// dbVersion is the on-disk layout version, bump it whenever the stored format changes
+// 1 - initial layout
+// 2 - blocks commit to the merkle root of their transactions
+// 3 - blocks record their proof of work target
+// 4 - blocks record their height, heights index of the main chain
+// 5 - cumulative work of every block, undo data of the main chain, orphan blocks
+// 6 - multisig outputs and inputs
+// 7 - script outputs and inputs, signature hashes covering the spent scripts
+// 8 - transaction lock times and input sequences
+// 9 - signature hashes covering the values of the spent outputs
+// 10 - signature hashes covering the genesis block hash
+const dbVersion = 10
+
+// maxOrphanBlocks caps the number of blocks kept while waiting for their parent
+const maxOrphanBlocks = 100
+
+// chainBuckets are the buckets of a blockchain database besides meta and the UTXO set
+var chainBuckets = []string{blocksBucket, heightsBucket, chainWorkBucket, undoBucket, orphansBucket}
+
+// blockIndexes are the optional indexes of the main chain, each one is enabled by creating its bucket
+var blockIndexes = []struct {
+	bucket     string
+	connect    func(*bolt.Bucket, *Block) error
+	disconnect func(*bolt.Bucket, *Block) error
+}{
+	{txIndexBucket, indexTransactions, unindexTransactions},
+	{addrIndexBucket, indexAddresses, unindexAddresses},
+}
+
+var tipKey = []byte("l")
+var versionKey = []byte("version")
+
+var (
+	// ErrBlockchainNotFound is returned when there is no database to open
+	ErrBlockchainNotFound = errors.New("No existing blockchain found. Create one first")
+	// ErrBlockchainExists is returned when creating a blockchain over an existing database
+	ErrBlockchainExists = errors.New("Blockchain already exists")
+	// ErrIncompatibleDB is returned when the database was written by an incompatible version
+	ErrIncompatibleDB = errors.New("Blockchain database was written by an incompatible version")
+	// ErrCorruptedDB is returned when the database doesn't have the expected buckets and keys
+	ErrCorruptedDB = errors.New("Blockchain database is corrupted")
+	// ErrBlockNotFound is returned when looking up a block that isn't stored
+	ErrBlockNotFound = errors.New("Block is not found")
+	// ErrInvalidBlock is returned when a block fails validation
+	ErrInvalidBlock = errors.New("Block is invalid")
+	// ErrOrphanBlock is returned when the parent of a block is unknown
+	ErrOrphanBlock = errors.New("Parent block is unknown")
+)
 
 // Blockchain is the chain holding blocks
 type Blockchain struct {
@@ -27,61 +84,226 @@ func (bc *Blockchain) Iterator() *BlockchainIterator {
 	return bci
 }
 
-// MineBlock is to add a new block to the blockchain
-func (bc *Blockchain) MineBlock(transactions []*Transaction) {
-	var lastHash []byte
+// MineBlock is to add a new block to the blockchain, the UTXO set is updated with the new block
+func (bc *Blockchain) MineBlock(transactions []*Transaction) *Block {
+	lastBlock, err := bc.GetBlock(bc.tip)
+	if err != nil {
+		log.Panic("Error get last block from db:", err)
+	}
+
+	timestamp, err := bc.nextTimestamp(lastBlock.Hash)
+	if err != nil {
+		log.Panic(err)
+	}
+	newBlock := newBlockAt(timestamp, transactions, lastBlock.Hash, lastBlock.Height+1, bc.nextTarget(lastBlock.Hash))
+
+	err = bc.db.Update(func(tx *bolt.Tx) error {
+		_, err := storeBlock(tx, newBlock)
+		if err != nil {
+			return err
+		}
+		err = UTXOSet{bc}.connectBlock(tx, newBlock)
+		if err != nil {
+			return err
+		}
+		return bc.setTip(tx, newBlock)
+	})
+	if err != nil {
+		log.Panic("Error adding block into db:", err)
+	}
+
+	return newBlock
+}
+
+// nextTimestamp returns the timestamp of a block mined now on top of the block of hash prev: the current time,
+// or just after the median time of the blocks before when the clock is behind it
+func (bc *Blockchain) nextTimestamp(prev []byte) (int64, error) {
+	median, err := bc.MedianTime(prev)
+	if err != nil {
+		return 0, err
+	}
+	if now := time.Now().Unix(); now > median {
+		return now, nil
+	}
+	return median + 1, nil
+}
+
+// storeBlock writes a block whose parent is stored along with its cumulative work, which it returns
+func storeBlock(tx *bolt.Tx, block *Block) (*big.Int, error) {
+	work := blockWork(block.Target)
+	w := tx.Bucket([]byte(chainWorkBucket))
+	if len(block.PrevBlockHash) != 0 {
+		work.Add(work, new(big.Int).SetBytes(w.Get(block.PrevBlockHash)))
+	}
+
+	err := tx.Bucket([]byte(blocksBucket)).Put(block.Hash, block.Serialize())
+	if err != nil {
+		return nil, err
+	}
+	err = w.Put(block.Hash, work.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	return work, nil
+}
+
+// ChainWork returns the cumulative work of the branch ending with the block of the given hash
+func (bc *Blockchain) ChainWork(blockHash []byte) (*big.Int, error) {
+	var work *big.Int
 
 	err := bc.db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(blocksBucket))
-		lastHash = b.Get([]byte("l"))
+		data := tx.Bucket([]byte(chainWorkBucket)).Get(blockHash)
+		if data == nil {
+			return ErrBlockNotFound
+		}
+		work = new(big.Int).SetBytes(data)
 		return nil
 	})
 
+	return work, err
+}
+
+// setTip makes block the tip of the chain and updates the height index to follow its branch
+// Entries are rewritten from the block down to the first height that already points to the branch,
+// and entries above the block are dropped. The optional indexes, when enabled, follow the same blocks
+func (bc *Blockchain) setTip(tx *bolt.Tx, block *Block) error {
+	b := tx.Bucket([]byte(blocksBucket))
+	h := tx.Bucket([]byte(heightsBucket))
+
+	err := b.Put(tipKey, block.Hash)
 	if err != nil {
-		log.Panic("Error get last hash from db:", err)
+		return err
 	}
 
-	newBlock := NewBlock(transactions, lastHash)
+	// disconnected holds the blocks leaving the main chain, connected the ones joining it
+	var disconnected, connected []*Block
 
-	err = bc.db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(blocksBucket))
-		err := b.Put(newBlock.Hash, newBlock.Serialize())
+	var stale [][]byte
+	c := h.Cursor()
+	for k, v := c.Seek(IntToHex(int64(block.Height + 1))); k != nil; k, v = c.Next() {
+		stale = append(stale, append([]byte{}, k...))
+		disconnected = append(disconnected, DeserializeBlock(b.Get(v)))
+	}
+	for _, k := range stale {
+		err = h.Delete(k)
+		if err != nil {
+			return err
+		}
+	}
+
+	current := block
+	for {
+		old := h.Get(IntToHex(int64(current.Height)))
+		if bytes.Compare(old, current.Hash) == 0 {
+			break
+		}
+		if old != nil {
+			disconnected = append(disconnected, DeserializeBlock(b.Get(old)))
+		}
+		err = h.Put(IntToHex(int64(current.Height)), current.Hash)
 		if err != nil {
-			log.Panic("Error adding block into db:", err)
+			return err
+		}
+		connected = append(connected, current)
+		if len(current.PrevBlockHash) == 0 {
+			break
+		}
+		current = DeserializeBlock(b.Get(current.PrevBlockHash))
+	}
+
+	for _, index := range blockIndexes {
+		i := tx.Bucket([]byte(index.bucket))
+		if i == nil {
+			continue
+		}
+		for _, block := range disconnected {
+			err = index.disconnect(i, block)
+			if err != nil {
+				return err
+			}
+		}
+		for _, block := range connected {
+			err = index.connect(i, block)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	bc.tip = block.Hash
+
+	return nil
+}
+
+// hasIndex tells whether the optional index stored in bucket is enabled
+func (bc *Blockchain) hasIndex(bucket string) bool {
+	enabled := false
+
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		enabled = tx.Bucket([]byte(bucket)) != nil
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return enabled
+}
+
+// rebuildIndex drops the optional index stored in bucket and connects every block of the main chain to it again
+func (bc *Blockchain) rebuildIndex(bucket string, connect func(*bolt.Bucket, *Block) error) error {
+	return bc.db.Update(func(tx *bolt.Tx) error {
+		err := tx.DeleteBucket([]byte(bucket))
+		if err != nil && err != bolt.ErrBucketNotFound {
+			return err
 		}
-		err = b.Put([]byte("l"), newBlock.Hash)
+
+		i, err := tx.CreateBucket([]byte(bucket))
 		if err != nil {
-			log.Panic("Error adding block into db:", err)
+			return err
 		}
-		bc.tip = newBlock.Hash
+
+		b := tx.Bucket([]byte(blocksBucket))
+		c := tx.Bucket([]byte(heightsBucket)).Cursor()
+		for _, blockHash := c.First(); blockHash != nil; _, blockHash = c.Next() {
+			err = connect(i, DeserializeBlock(b.Get(blockHash)))
+			if err != nil {
+				return err
+			}
+		}
+
 		return nil
 	})
 }
 
-// FindUnspentTransactions returns a list of transactions containing unspent outputs
-func (bc *Blockchain) FindUnspentTransactions(pubKeyHash []byte) []Transaction {
-	// make a list of unspent transactions
-	var unspentTxs []Transaction
+// FindUTXO walks the whole chain and returns all unspent transaction outputs keyed by transaction ID
+// It is expensive, use UTXOSet for lookups and only call this to build the UTXO set
+func (bc *Blockchain) FindUTXO() map[string]TxOutputs {
+	return bc.FindUTXOWithProgress(nil)
+}
+
+// FindUTXOWithProgress works like FindUTXO and calls progress, if not nil, with the number of blocks scanned so far
+func (bc *Blockchain) FindUTXOWithProgress(progress func(blocks int)) map[string]TxOutputs {
+	UTXO := make(map[string]TxOutputs)
 	// make a map to store spent transactions' outputs
 	// key - hash string of transaction
 	// value - an int array storing index
 	spentTXOs := make(map[string][]int)
 	bci := bc.Iterator()
+	scanned := 0
 
 	// traverse the all blocks in a blockchain
 	for {
 		block := bci.Next()
+		scanned++
 		// have to get all used outputs from all inputs first
 		for _, tx := range block.Transactions {
-			// if a transaction is not coinbase, traverse the inputs to add all outputs of it into spentTXOs
 			// a coinbase transaction doesn't have ins
 			if tx.isCoinbase() == false {
 				for _, in := range tx.Vin {
-					if in.UsesKey(pubKeyHash) {
-						// notice that inputs are not consuming outputs within the same transaction
-						inTxID := hex.EncodeToString(in.Txid)
-						spentTXOs[inTxID] = append(spentTXOs[inTxID], in.Vout)
-					}
+					inTxID := hex.EncodeToString(in.Txid)
+					spentTXOs[inTxID] = append(spentTXOs[inTxID], in.Vout)
 				}
 			}
 		}
@@ -89,77 +311,59 @@ func (bc *Blockchain) FindUnspentTransactions(pubKeyHash []byte) []Transaction {
 		for _, tx := range block.Transactions {
 			txID := hex.EncodeToString(tx.ID)
 		Outputs:
-			// traverse the outputs in a transaction of one single block
 			for outIdx, out := range tx.Vout {
-				if spentTXOs[txID] != nil {
-					for _, spentOut := range spentTXOs[txID] {
-						if spentOut == outIdx { // the output is already stored and spent
-							continue Outputs
-						}
+				for _, spentOut := range spentTXOs[txID] {
+					if spentOut == outIdx { // the output is already spent by a later transaction
+						continue Outputs
 					}
 				}
-				// if the output can be unlock, add it to unspent tx of this address
-				if out.IsLockedWithKey(pubKeyHash) {
-					unspentTxs = append(unspentTxs, *tx)
+
+				outs, ok := UTXO[txID]
+				if !ok {
+					outs = NewTxOutputs()
+					UTXO[txID] = outs
 				}
+				outs.Outputs[outIdx] = out
 			}
 		}
+		if progress != nil {
+			progress(scanned)
+		}
 		// reach the end of the blockchain
 		if len(block.PrevBlockHash) == 0 {
 			break
 		}
 	}
-	return unspentTxs
+	return UTXO
 }
 
-// FindUTXO return a list of unspent transaction outputs
-func (bc *Blockchain) FindUTXO(pubKeyHash []byte) []TxOutput {
-	var UTXOs []TxOutput
-	unspentTransactions := bc.FindUnspentTransactions(pubKeyHash)
-
-	for _, tx := range unspentTransactions {
-		for _, out := range tx.Vout {
-			if out.IsLockedWithKey(pubKeyHash) {
-				UTXOs = append(UTXOs, out)
-			}
-		}
-	}
-
-	return UTXOs
+// FindTransaction obtains previouse transactions by ID
+func (bc *Blockchain) FindTransaction(ID []byte) (Transaction, error) {
+	return bc.findTransactionFrom(bc.tip, ID)
 }
 
-// FindSpendableOutputs uses FindUnspentTransactions to gather all utxos that can fullfil the amount
-func (bc *Blockchain) FindSpendableOutputs(pubKeyHash []byte, amount int) (int, map[string][]int) {
-	unspentOutputs := make(map[string][]int)
-	unspentTXs := bc.FindUnspentTransactions(pubKeyHash)
-	accumulated := 0
-
-Work:
-	for _, tx := range unspentTXs {
-		txID := hex.EncodeToString(tx.ID)
-		for outIdx, out := range tx.Vout {
-			if out.IsLockedWithKey(pubKeyHash) && accumulated < amount {
-				accumulated += out.Value
-				unspentOutputs[txID] = append(unspentOutputs[txID], outIdx)
-				if accumulated >= amount {
-					break Work
-				}
-			}
-		}
-	}
-	return accumulated, unspentOutputs
+// findTransactionFrom looks for a transaction in the branch ending with the block of hash from
+func (bc *Blockchain) findTransactionFrom(from []byte, ID []byte) (Transaction, error) {
+	tx, _, err := bc.findTransactionBlockFrom(from, ID)
+	return tx, err
 }
 
-// FindTransaction obtains previouse transactions by ID
-func (bc *Blockchain) FindTransaction(ID []byte) (Transaction, error) {
+// FindSpendingTransaction walks the main chain from the tip for the transaction spending output vout of the
+// transaction txID
+func (bc *Blockchain) FindSpendingTransaction(txID []byte, vout int) (Transaction, error) {
 	bci := bc.Iterator()
 
 	for {
 		block := bci.Next()
 
 		for _, tx := range block.Transactions {
-			if bytes.Compare(tx.ID, ID) == 0 {
-				return *tx, nil
+			if tx.isCoinbase() {
+				continue
+			}
+			for _, vin := range tx.Vin {
+				if bytes.Compare(vin.Txid, txID) == 0 && vin.Vout == vout {
+					return *tx, nil
+				}
 			}
 		}
 
@@ -167,7 +371,7 @@ func (bc *Blockchain) FindTransaction(ID []byte) (Transaction, error) {
 			break
 		}
 	}
-	return Transaction{}, errors.New("Transaction is not found")
+	return Transaction{}, ErrTransactionNotFound
 }
 
 // SignTransaction sighs a transaction
@@ -181,77 +385,625 @@ func (bc *Blockchain) SignTransaction(tx *Transaction, privKey ecdsa.PrivateKey)
 		}
 		prevTxs[hex.EncodeToString(prevTx.ID)] = prevTx
 	}
-	tx.Sign(privKey, prevTxs)
+	tx.Sign(privKey, prevTxs, bc.GenesisHash())
 }
 
-// VerifyTransaction verifies a transaction
+// VerifyTransaction verifies a transaction, a transaction spending unknown outputs is invalid
 func (bc *Blockchain) VerifyTransaction(tx *Transaction) bool {
+	return bc.verifyTransactionFrom(bc.tip, tx)
+}
+
+// verifyTransactionFrom verifies a transaction against the branch ending with the block of hash from, as part
+// of the block following it
+func (bc *Blockchain) verifyTransactionFrom(from []byte, tx *Transaction) bool {
+	if tx.isCoinbase() {
+		return true
+	}
+
+	parent, err := bc.GetBlock(from)
+	if err != nil {
+		return false
+	}
+
+	prevTxs, err := bc.findPrevTransactionsFrom(from, tx)
+	if err != nil {
+		return false
+	}
+
+	// a transaction can't create coins, what it doesn't spend goes to the miner
+	if _, err := transactionFee(tx, prevTxs); err != nil {
+		return false
+	}
+
+	return tx.Verify(prevTxs, parent.Height+1, bc.GenesisHash())
+}
+
+// TransactionFee returns what a transaction leaves to the miner, the value of its inputs minus its outputs
+func (bc *Blockchain) TransactionFee(tx *Transaction) (int, error) {
+	return bc.transactionFeeFrom(bc.tip, tx)
+}
+
+// TotalFees returns the sum of the fees of verified transactions, the reward of the block mining them
+func (bc *Blockchain) TotalFees(txs []*Transaction) int {
+	fees := 0
+	for _, tx := range txs {
+		fee, err := bc.TransactionFee(tx)
+		if err != nil {
+			log.Panic(err)
+		}
+		fees += fee
+	}
+	return fees
+}
+
+// transactionFeeFrom returns the fee of a transaction spending outputs of the branch ending with from
+func (bc *Blockchain) transactionFeeFrom(from []byte, tx *Transaction) (int, error) {
+	if tx.isCoinbase() {
+		return 0, nil
+	}
+
+	prevTxs, err := bc.findPrevTransactionsFrom(from, tx)
+	if err != nil {
+		return 0, err
+	}
+
+	return transactionFee(tx, prevTxs)
+}
+
+// findPrevTransactionsFrom finds the transactions whose outputs tx spends, keyed by hex encoded ID
+func (bc *Blockchain) findPrevTransactionsFrom(from []byte, tx *Transaction) (map[string]Transaction, error) {
+	if len(tx.Vin) == 0 {
+		return nil, errors.New("Transaction has no inputs")
+	}
+
 	prevTxs := make(map[string]Transaction)
 
 	for _, vin := range tx.Vin {
-		prevTx, err := bc.FindTransaction(vin.Txid)
+		prevTx, err := bc.findTransactionFrom(from, vin.Txid)
 		if err != nil {
-			log.Panic(err)
+			return nil, err
+		}
+		if vin.Vout < 0 || vin.Vout >= len(prevTx.Vout) {
+			return nil, fmt.Errorf("Transaction %x has no output %d", vin.Txid, vin.Vout)
 		}
 		prevTxs[hex.EncodeToString(prevTx.ID)] = prevTx
 	}
-	return tx.Verify(prevTxs)
+
+	return prevTxs, nil
+}
+
+// transactionFee returns the value of the inputs of tx minus its outputs
+func transactionFee(tx *Transaction, prevTxs map[string]Transaction) (int, error) {
+	return spentOutputsFee(tx, tx.spentOutputs(prevTxs))
+}
+
+// spentOutputsFee works like transactionFee, with the outputs the inputs of tx spend, in the same order
+func spentOutputsFee(tx *Transaction, prevOuts []TxOutput) (int, error) {
+	inputValue := 0
+	for inID, prevOut := range prevOuts {
+		value := prevOut.Value
+		if value < 0 || value > maxMoney {
+			return 0, fmt.Errorf("Transaction %x input %d spends an invalid value %d", tx.ID, inID, value)
+		}
+		inputValue += value
+		if inputValue > maxMoney {
+			return 0, fmt.Errorf("Transaction %x spends more than %d", tx.ID, maxMoney)
+		}
+	}
+
+	outputValue, err := tx.OutputValue()
+	if err != nil {
+		return 0, err
+	}
+
+	if outputValue > inputValue {
+		return 0, fmt.Errorf("Transaction %x spends %d but has only %d", tx.ID, outputValue, inputValue)
+	}
+
+	return inputValue - outputValue, nil
 }
 
-// NewBlockchain create a new blockchain with the first block is genesis block. if there exists blockchain already,do nothing and return a blochchain pointer
-func NewBlockchain(address string) *Blockchain {
-	if !dbExists() {
-		fmt.Println("No existing blockchain found. Create one first")
-		os.Exit(1)
+// checkReward checks that the coinbase of a block pays valid values, adding up to no more than the subsidy and
+// the fees of the block
+func checkReward(coinbase *Transaction, fees int) error {
+	reward, err := coinbase.OutputValue()
+	if err != nil {
+		return err
+	}
+	if reward > subsidy+fees {
+		return fmt.Errorf("Coinbase pays %d, more than the subsidy and fees %d", reward, subsidy+fees)
 	}
+	return nil
 }
 
-// CreateBlockchain creates a blockchain with default address in it
-func CreateBlockchain(address string) *Blockchain {
-	if dbExists() {
-		fmt.Println("Blockchain already exists.")
-		os.Exit(1)
+// HasBlock tells whether the block with the given hash is stored, on the main chain or not
+func (bc *Blockchain) HasBlock(blockHash []byte) bool {
+	found := false
+
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(blocksBucket))
+		found = b.Get(blockHash) != nil
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
 	}
 
-	var tip []byte
+	return found
+}
 
-	cbtx := NewCoinbaseTX(address, genesisCoinbaseData)
-	genesis := NewGenesisBlock(cbtx)
+// GetBlock finds a block by its hash and returns it
+func (bc *Blockchain) GetBlock(blockHash []byte) (*Block, error) {
+	var block *Block
+
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(blocksBucket))
+		blockData := b.Get(blockHash)
+		if blockData == nil {
+			return ErrBlockNotFound
+		}
+		block = DeserializeBlock(blockData)
+		return nil
+	})
+
+	return block, err
+}
+
+// nextTarget returns the target the chain rules expect for a block whose parent is prevHash
+// It is recomputed every retargetInterval blocks from the time the previous interval took, otherwise it
+// stays the target of the parent
+func (bc *Blockchain) nextTarget(prevHash []byte) *big.Int {
+	if len(prevHash) == 0 {
+		return maxTarget()
+	}
 
-	db, err := bolt.Open(dbFile, 0600, nil)
+	prev, err := bc.GetBlock(prevHash)
 	if err != nil {
 		log.Panic(err)
 	}
+	height := prev.Height + 1
+	if height%retargetInterval != 0 {
+		return new(big.Int).SetBytes(prev.Target)
+	}
 
-	err = db.Update(func(tx *bolt.Tx) error {
-		b, err := tx.CreateBucket([]byte(blocksBucket))
+	// walk back to the first block of the interval, which ends with prev
+	first := prev
+	for i := 0; i < retargetInterval-1; i++ {
+		first, err = bc.GetBlock(first.PrevBlockHash)
 		if err != nil {
 			log.Panic(err)
 		}
+	}
+
+	return targetAfterInterval(first, prev)
+}
+
+// GetBlockByHeight finds the block of the main chain at the given height and returns it
+func (bc *Blockchain) GetBlockByHeight(height int) (*Block, error) {
+	var block *Block
+
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		blockHash := tx.Bucket([]byte(heightsBucket)).Get(IntToHex(int64(height)))
+		if blockHash == nil {
+			return fmt.Errorf("%w: no block at height %d", ErrBlockNotFound, height)
+		}
+		blockData := tx.Bucket([]byte(blocksBucket)).Get(blockHash)
+		if blockData == nil {
+			return fmt.Errorf("%w: %x indexed at height %d", ErrCorruptedDB, blockHash, height)
+		}
+		block = DeserializeBlock(blockData)
+		return nil
+	})
+
+	return block, err
+}
+
+// LeftBehind returns the blocks from oldTip down to the main chain, oldest first, which a reorganization
+// disconnected. It returns nothing while oldTip is still on the main chain
+func (bc *Blockchain) LeftBehind(oldTip []byte) ([]*Block, error) {
+	var blocks []*Block
+
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(blocksBucket))
+		h := tx.Bucket([]byte(heightsBucket))
+
+		current := oldTip
+		for {
+			blockData := b.Get(current)
+			if blockData == nil {
+				return fmt.Errorf("%w: %x", ErrBlockNotFound, current)
+			}
+			block := DeserializeBlock(blockData)
+			if bytes.Compare(h.Get(IntToHex(int64(block.Height))), block.Hash) == 0 {
+				return nil
+			}
+			blocks = append([]*Block{block}, blocks...)
+			current = block.PrevBlockHash
+		}
+	})
+
+	return blocks, err
+}
+
+// GenesisHash returns the hash of the genesis block, which transaction signatures commit to so they are only
+// valid on this chain
+func (bc *Blockchain) GenesisHash() []byte {
+	var genesis []byte
+
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		// copy the hash, the slice returned by bolt is only valid inside the transaction
+		genesis = append([]byte{}, tx.Bucket([]byte(heightsBucket)).Get(IntToHex(0))...)
+		if len(genesis) == 0 {
+			return fmt.Errorf("%w: no block at height 0", ErrCorruptedDB)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return genesis
+}
+
+// GetBestHeight returns the height of the tip, the genesis block has height 0
+func (bc *Blockchain) GetBestHeight() int {
+	tip, err := bc.GetBlock(bc.tip)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return tip.Height
+}
+
+// GetBlockHashes returns the hashes of all blocks in the main chain, from the tip to the genesis block
+func (bc *Blockchain) GetBlockHashes() [][]byte {
+	var blocks [][]byte
+
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(heightsBucket)).Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			blocks = append(blocks, append([]byte{}, v...))
+		}
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return blocks
+}
+
+// AddBlock validates a block received from another node and stores it
+// A block whose parent is unknown is kept as an orphan until the parent is added. The block becomes the new
+// tip when its branch has more cumulative work than the main chain: the blocks of the main chain down to the
+// fork are disconnected and the ones of the branch connected, and the chain is left untouched if one of them
+// spends outputs that are not available or repeats the ID of a transaction with unspent outputs. Adding a known
+// block does nothing
+func (bc *Blockchain) AddBlock(block *Block) error {
+	if bc.HasBlock(block.Hash) {
+		return nil
+	}
 
-		err = b.Put(genesis.Hash, genesis.Serialize())
+	if len(block.Transactions) == 0 {
+		return fmt.Errorf("%w: block %x has no transactions", ErrInvalidBlock, block.Hash)
+	}
+	if txID := block.DuplicateTransaction(); txID != nil {
+		return fmt.Errorf("%w: block %x repeats transaction %x", ErrInvalidBlock, block.Hash, txID)
+	}
+	if !NewProofOfWork(block).Validate() {
+		return fmt.Errorf("%w: block %x has an invalid proof of work", ErrInvalidBlock, block.Hash)
+	}
+	if len(block.PrevBlockHash) == 0 {
+		return fmt.Errorf("%w: block %x is a different genesis block", ErrInvalidBlock, block.Hash)
+	}
+	parent, err := bc.GetBlock(block.PrevBlockHash)
+	if err != nil {
+		err = bc.addOrphan(block)
 		if err != nil {
-			log.Panic(err)
+			return err
+		}
+		return fmt.Errorf("%w: parent %x of block %x", ErrOrphanBlock, block.PrevBlockHash, block.Hash)
+	}
+	if block.Height != parent.Height+1 {
+		return fmt.Errorf("%w: block %x has height %d, expected %d", ErrInvalidBlock, block.Hash, block.Height, parent.Height+1)
+	}
+	if new(big.Int).SetBytes(block.Target).Cmp(bc.nextTarget(block.PrevBlockHash)) != 0 {
+		return fmt.Errorf("%w: block %x has target %x, expected %x", ErrInvalidBlock, block.Hash, block.Target, bc.nextTarget(block.PrevBlockHash))
+	}
+	if ahead := block.Timestamp - time.Now().Unix(); ahead > maxFutureBlockTime {
+		return fmt.Errorf("%w: block %x is timestamped %d seconds in the future", ErrInvalidBlock, block.Hash, ahead)
+	}
+	// the median time the time locks compare with only moves forward
+	median, err := bc.MedianTime(block.PrevBlockHash)
+	if err != nil {
+		return err
+	}
+	if block.Timestamp <= median {
+		return fmt.Errorf("%w: block %x is timestamped %d, not after the median time %d", ErrInvalidBlock, block.Hash, block.Timestamp, median)
+	}
+
+	// a transaction with the ID of one with unspent outputs would overwrite them, the UTXO set only tells for
+	// blocks on top of the tip, connecting the blocks of a branch checks the others
+	extendsTip := bytes.Equal(block.PrevBlockHash, bc.tip)
+	fees := 0
+	for i, tx := range block.Transactions {
+		if bytes.Compare(tx.ID, tx.Hash()) != 0 {
+			return fmt.Errorf("%w: transaction %x has a wrong ID", ErrInvalidBlock, tx.ID)
+		}
+		if extendsTip && (UTXOSet{bc}).HasOutputs(tx.ID) {
+			return fmt.Errorf("%w: transaction %x already has unspent outputs", ErrInvalidBlock, tx.ID)
+		}
+		if tx.isCoinbase() != (i == 0) {
+			return fmt.Errorf("%w: block %x must start with its only coinbase", ErrInvalidBlock, block.Hash)
+		}
+		if !bc.verifyTransactionFrom(block.PrevBlockHash, tx) {
+			return fmt.Errorf("%w: transaction %x doesn't verify", ErrInvalidBlock, tx.ID)
+		}
+		err := bc.checkLockTimesFrom(block.PrevBlockHash, tx)
+		if err != nil {
+			return fmt.Errorf("%w: transaction %x: %v", ErrInvalidBlock, tx.ID, err)
 		}
 
-		err = b.Put([]byte("l"), genesis.Hash)
+		fee, err := bc.transactionFeeFrom(block.PrevBlockHash, tx)
 		if err != nil {
-			log.Panic(err)
+			return fmt.Errorf("%w: %v", ErrInvalidBlock, err)
+		}
+		fees += fee
+	}
+
+	if err := checkReward(block.Transactions[0], fees); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidBlock, err)
+	}
+
+	tip := bc.tip
+	err = bc.db.Update(func(tx *bolt.Tx) error {
+		work, err := storeBlock(tx, block)
+		if err != nil {
+			return err
+		}
+
+		tipWork := new(big.Int).SetBytes(tx.Bucket([]byte(chainWorkBucket)).Get(bc.tip))
+		if work.Cmp(tipWork) <= 0 {
+			return nil
+		}
+		return bc.reorganize(tx, block)
+	})
+	if err != nil {
+		// the db transaction is rolled back, so is the tip
+		bc.tip = tip
+		return err
+	}
+
+	return bc.addOrphansOf(block)
+}
+
+// reorganize makes block the tip of the chain, disconnecting the blocks of the main chain above the fork
+// point from the UTXO set then connecting the blocks of the branch
+func (bc *Blockchain) reorganize(tx *bolt.Tx, block *Block) error {
+	b := tx.Bucket([]byte(blocksBucket))
+	h := tx.Bucket([]byte(heightsBucket))
+	UTXOSet := UTXOSet{bc}
+
+	// walk the branch back to the main chain
+	var connect []*Block
+	fork := block
+	for bytes.Compare(h.Get(IntToHex(int64(fork.Height))), fork.Hash) != 0 {
+		connect = append(connect, fork)
+		fork = DeserializeBlock(b.Get(fork.PrevBlockHash))
+	}
+
+	for current := DeserializeBlock(b.Get(bc.tip)); bytes.Compare(current.Hash, fork.Hash) != 0; {
+		err := UTXOSet.disconnectBlock(tx, current)
+		if err != nil {
+			return err
+		}
+		current = DeserializeBlock(b.Get(current.PrevBlockHash))
+	}
+
+	for i := len(connect) - 1; i >= 0; i-- {
+		err := UTXOSet.connectBlock(tx, connect[i])
+		if err != nil {
+			return fmt.Errorf("%w: block %x: %v", ErrInvalidBlock, connect[i].Hash, err)
 		}
-		tip = genesis.Hash
+	}
+
+	return bc.setTip(tx, block)
+}
 
+// addOrphan keeps a block whose parent is unknown, dropping another orphan if there are too many
+func (bc *Blockchain) addOrphan(block *Block) error {
+	return bc.db.Update(func(tx *bolt.Tx) error {
+		o := tx.Bucket([]byte(orphansBucket))
+		c := o.Cursor()
+		count := 0
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			count++
+		}
+		if count >= maxOrphanBlocks {
+			k, _ := c.First()
+			err := o.Delete(k)
+			if err != nil {
+				return err
+			}
+		}
+		return o.Put(block.Hash, block.Serialize())
+	})
+}
+
+// addOrphansOf adds the orphans waiting for block, and in turn the orphans waiting for them
+// Orphans that turn out to be invalid are dropped
+func (bc *Blockchain) addOrphansOf(block *Block) error {
+	var children []*Block
+
+	err := bc.db.Update(func(tx *bolt.Tx) error {
+		o := tx.Bucket([]byte(orphansBucket))
+		c := o.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			orphan := DeserializeBlock(v)
+			if bytes.Compare(orphan.PrevBlockHash, block.Hash) == 0 {
+				children = append(children, orphan)
+			}
+		}
+		for _, child := range children {
+			err := o.Delete(child.Hash)
+			if err != nil {
+				return err
+			}
+		}
 		return nil
 	})
 	if err != nil {
-		log.Panic(err)
+		return err
+	}
+
+	for _, child := range children {
+		err = bc.AddBlock(child)
+		if err != nil && !errors.Is(err, ErrInvalidBlock) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// NewBlockchain opens an existing blockchain of a node and loads its tip.
+// The database is checked for its layout and version before a Blockchain is returned
+func NewBlockchain(nodeID string) (*Blockchain, error) {
+	dbFile := dbPath(nodeID)
+	if !dbExists(dbFile) {
+		return nil, ErrBlockchainNotFound
+	}
+
+	var tip []byte
+
+	db, err := openDB(dbFile)
+	switch err {
+	case nil:
+	case bolt.ErrInvalid, bolt.ErrChecksum:
+		return nil, fmt.Errorf("%w: %v", ErrCorruptedDB, err)
+	case bolt.ErrVersionMismatch:
+		return nil, fmt.Errorf("%w: %v", ErrIncompatibleDB, err)
+	default:
+		return nil, err
+	}
+
+	err = db.View(func(tx *bolt.Tx) error {
+		m := tx.Bucket([]byte(metaBucket))
+		if m == nil {
+			return ErrIncompatibleDB
+		}
+		if bytes.Compare(m.Get(versionKey), IntToHex(dbVersion)) != 0 {
+			return ErrIncompatibleDB
+		}
+
+		b := tx.Bucket([]byte(blocksBucket))
+		if b == nil {
+			return fmt.Errorf("%w: missing %s bucket", ErrCorruptedDB, blocksBucket)
+		}
+		// copy the tip, the slice returned by bolt is only valid inside the transaction
+		tip = append([]byte{}, b.Get(tipKey)...)
+		if len(tip) == 0 {
+			return fmt.Errorf("%w: missing tip", ErrCorruptedDB)
+		}
+		if b.Get(tip) == nil {
+			return fmt.Errorf("%w: tip block %x not found", ErrCorruptedDB, tip)
+		}
+
+		// the blocks bucket is checked above
+		for _, bucket := range chainBuckets[1:] {
+			if tx.Bucket([]byte(bucket)) == nil {
+				return fmt.Errorf("%w: missing %s bucket", ErrCorruptedDB, bucket)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
 	}
 
 	bc := Blockchain{tip, db}
 
-	return &bc
+	return &bc, nil
+}
+
+// CreateBlockchain creates a blockchain for a node, the genesis block rewards address
+// genesisData is the coinbase data of the genesis block, genesisCoinbaseData if empty. Chains with different
+// data have different genesis coinbases even when they reward the same address
+func CreateBlockchain(address, genesisData, nodeID string) (*Blockchain, error) {
+	dbFile := dbPath(nodeID)
+	if dbExists(dbFile) {
+		return nil, ErrBlockchainExists
+	}
+
+	if genesisData == "" {
+		genesisData = genesisCoinbaseData
+	}
+	cbtx := NewCoinbaseTX(address, genesisData)
+	genesis := NewGenesisBlock(cbtx)
+
+	db, err := openDB(dbFile)
+	if err != nil {
+		return nil, err
+	}
+	bc := Blockchain{nil, db}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		m, err := tx.CreateBucket([]byte(metaBucket))
+		if err != nil {
+			return err
+		}
+
+		err = m.Put(versionKey, IntToHex(dbVersion))
+		if err != nil {
+			return err
+		}
+
+		for _, bucket := range chainBuckets {
+			_, err = tx.CreateBucket([]byte(bucket))
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = storeBlock(tx, genesis)
+		if err != nil {
+			return err
+		}
+
+		return bc.setTip(tx, genesis)
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	UTXOSet := UTXOSet{&bc}
+	UTXOSet.Reindex()
+
+	return &bc, nil
+}
+
+// Close releases the underlying database so the blockchain can be opened again
+func (bc *Blockchain) Close() error {
+	return bc.db.Close()
+}
+
+// dbPath returns the database file of a node, nodes without an ID share the default file
+func dbPath(nodeID string) string {
+	if nodeID == "" {
+		return dbFile
+	}
+	return fmt.Sprintf(nodeDBFile, nodeID)
+}
+
+// openDB opens the database file, failing instead of blocking forever if another handle holds the lock
+func openDB(dbFile string) (*bolt.DB, error) {
+	return bolt.Open(dbFile, 0600, &bolt.Options{Timeout: 1 * time.Second})
 }
 
-func dbExists() bool {
+func dbExists(dbFile string) bool {
 	if _, err := os.Stat(dbFile); os.IsNotExist(err) {
 		return false
 	}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+func TestHeightIndexFollowsTheLongestBranch(t *testing.T) {
+	defer useTestDir(t)()
+
+	wallet := NewWallet()
+	address := string(wallet.GetAddress())
+	bc, err := CreateBlockchain(address, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.Close()
+
+	genesis := bc.tip
+	old := bc.MineBlock([]*Transaction{NewCoinbaseTX(address, "")})
+
+	// a longer branch from the genesis block replaces the block at height 1
+	first := nextBlock(t, bc, genesis, NewCoinbaseTX(address, ""))
+	if err := bc.AddBlock(first); err != nil {
+		t.Fatal(err)
+	}
+	second := nextBlock(t, bc, first.Hash, NewCoinbaseTX(address, ""))
+	if err := bc.AddBlock(second); err != nil {
+		t.Fatal(err)
+	}
+
+	if height := bc.GetBestHeight(); height != 2 {
+		t.Fatalf("best height = %d, want 2", height)
+	}
+	for height, want := range [][]byte{genesis, first.Hash, second.Hash} {
+		block, err := bc.GetBlockByHeight(height)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(block.Hash, want) {
+			t.Errorf("block at height %d = %x, want %x", height, block.Hash, want)
+		}
+	}
+	if _, err := bc.GetBlockByHeight(3); !errors.Is(err, ErrBlockNotFound) {
+		t.Errorf("block above the tip: got %v, want %v", err, ErrBlockNotFound)
+	}
+	if _, err := bc.GetBlock(old.Hash); err != nil {
+		t.Errorf("block of the old branch: %v", err)
+	}
+
+	hashes := bc.GetBlockHashes()
+	if len(hashes) != 3 || !bytes.Equal(hashes[0], second.Hash) || !bytes.Equal(hashes[2], genesis) {
+		t.Errorf("block hashes = %x, want the main chain from the tip", hashes)
+	}
+
+	wrong := NewBlock([]*Transaction{NewCoinbaseTX(address, "")}, second.Hash, 5, bc.nextTarget(second.Hash))
+	if err := bc.AddBlock(wrong); !errors.Is(err, ErrInvalidBlock) {
+		t.Errorf("block with a wrong height: got %v, want %v", err, ErrInvalidBlock)
+	}
+}
+
+// nextBlock mines a block of txs on top of the stored block of hash parent, the way MineBlock does
+func nextBlock(t *testing.T, bc *Blockchain, parent []byte, txs ...*Transaction) *Block {
+	block, err := bc.GetBlock(parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	timestamp, err := bc.nextTimestamp(parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newBlockAt(timestamp, txs, parent, block.Height+1, bc.nextTarget(parent))
+}
+
+// branchBlock mines a block on top of parent, with the parent's target which holds until the first retarget
+// The parent doesn't have to be stored, the block is timestamped after it to be after the median time
+func branchBlock(parent *Block, txs ...*Transaction) *Block {
+	timestamp := time.Now().Unix()
+	if timestamp <= parent.Timestamp {
+		timestamp = parent.Timestamp + 1
+	}
+	return newBlockAt(timestamp, txs, parent.Hash, parent.Height+1, new(big.Int).SetBytes(parent.Target))
+}
+
+func balanceOf(bc *Blockchain, wallet *Wallet) int {
+	balance := 0
+	for _, out := range (UTXOSet{bc}).FindUTXO(HashPubKey(wallet.PublicKey)) {
+		balance += out.Value
+	}
+	return balance
+}
+
+func TestReorganizeToTheMostWorkChain(t *testing.T) {
+	defer useTestDir(t)()
+
+	alice := NewWallet()
+	bob := NewWallet()
+	address := string(alice.GetAddress())
+	bc, err := CreateBlockchain(address, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.Close()
+
+	genesis, err := bc.GetBlock(bc.tip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pay := spendOutput(bc, alice, genesis.Transactions[0].ID, 0, subsidy, string(bob.GetAddress()))
+	a1 := bc.MineBlock([]*Transaction{NewCoinbaseTX(address, ""), pay})
+	if balanceOf(bc, bob) != subsidy {
+		t.Fatalf("bob has %d before the reorganization, want %d", balanceOf(bc, bob), subsidy)
+	}
+
+	// a heavier branch without the payment arrives, its second block first
+	b1 := branchBlock(genesis, NewCoinbaseTX(address, ""))
+	b2 := branchBlock(b1, NewCoinbaseTX(address, ""))
+	if err := bc.AddBlock(b2); !errors.Is(err, ErrOrphanBlock) {
+		t.Fatalf("block with an unknown parent: got %v, want %v", err, ErrOrphanBlock)
+	}
+	if err := bc.AddBlock(b1); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(bc.tip, b2.Hash) {
+		t.Fatalf("tip = %x, want the orphan %x once its parent is known", bc.tip, b2.Hash)
+	}
+	if balanceOf(bc, bob) != 0 || balanceOf(bc, alice) != 3*subsidy {
+		t.Errorf("balances after the reorganization: alice %d, bob %d", balanceOf(bc, alice), balanceOf(bc, bob))
+	}
+
+	// the first branch takes over again and brings the payment back
+	a2 := branchBlock(a1, NewCoinbaseTX(address, ""))
+	a3 := branchBlock(a2, NewCoinbaseTX(address, ""))
+	for _, block := range []*Block{a2, a3} {
+		if err := bc.AddBlock(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(bc.tip, a3.Hash) || balanceOf(bc, bob) != subsidy {
+		t.Errorf("tip %x and bob %d after switching back, want %x and %d", bc.tip, balanceOf(bc, bob), a3.Hash, subsidy)
+	}
+
+	// the UTXO set rolled back and forth matches one built from scratch
+	before := (UTXOSet{bc}).Stats()
+	(UTXOSet{bc}).Reindex()
+	if after := (UTXOSet{bc}).Stats(); before != after {
+		t.Errorf("UTXO set after reorganizations %+v, rebuilt %+v", before, after)
+	}
+}
+
+func TestReorganizeRejectsDoubleSpends(t *testing.T) {
+	defer useTestDir(t)()
+
+	alice := NewWallet()
+	address := string(alice.GetAddress())
+	bob := string(NewWallet().GetAddress())
+	bc, err := CreateBlockchain(address, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.Close()
+
+	genesis, err := bc.GetBlock(bc.tip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tip := bc.MineBlock([]*Transaction{NewCoinbaseTX(address, "")})
+
+	// each block of the branch looks fine on its own, but both spend the genesis reward
+	first := branchBlock(genesis, NewCoinbaseTX(address, ""), spendOutput(bc, alice, genesis.Transactions[0].ID, 0, subsidy, bob))
+	second := branchBlock(first, NewCoinbaseTX(address, ""), spendOutput(bc, alice, genesis.Transactions[0].ID, 0, subsidy-1, bob))
+	if err := bc.AddBlock(first); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.AddBlock(second); !errors.Is(err, ErrInvalidBlock) {
+		t.Errorf("branch spending an output twice: got %v, want %v", err, ErrInvalidBlock)
+	}
+
+	if !bytes.Equal(bc.tip, tip.Hash) || bc.HasBlock(second.Hash) {
+		t.Errorf("the chain changed after a failed reorganization")
+	}
+	if balanceOf(bc, alice) != 2*subsidy {
+		t.Errorf("alice has %d, want %d", balanceOf(bc, alice), 2*subsidy)
+	}
+}
+
+func TestAddBlockRejectsRepeatedTransactions(t *testing.T) {
+	defer useTestDir(t)()
+
+	wallet := NewWallet()
+	address := string(wallet.GetAddress())
+	bob := string(NewWallet().GetAddress())
+	bc, err := CreateBlockchain(address, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.Close()
+
+	genesis, err := bc.GetBlock(bc.tip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent := bc.MineBlock([]*Transaction{NewCoinbaseTX(address, "")})
+	first := spendOutput(bc, wallet, genesis.Transactions[0].ID, 0, subsidy, bob)
+	second := spendOutput(bc, wallet, parent.Transactions[0].ID, 0, subsidy, bob)
+	bc.MineBlock([]*Transaction{NewCoinbaseTX(address, "")})
+
+	// the block is on a branch with as much work as the main chain, it is stored without being connected
+	block := branchBlock(parent, NewCoinbaseTX(address, ""), first, second)
+
+	// three transactions are padded with the last one, repeating it keeps the merkle root and the hash
+	mutated := *block
+	mutated.Transactions = append(append([]*Transaction{}, block.Transactions...), second)
+	if !NewProofOfWork(&mutated).Validate() {
+		t.Fatal("the mutated block doesn't have the hash of the block")
+	}
+	if err := bc.AddBlock(&mutated); !errors.Is(err, ErrInvalidBlock) {
+		t.Fatalf("block repeating a transaction: got %v, want %v", err, ErrInvalidBlock)
+	}
+	if err := bc.AddBlock(block); err != nil {
+		t.Fatal(err)
+	}
+	child := branchBlock(block, NewCoinbaseTX(address, ""))
+	if err := bc.AddBlock(child); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(bc.tip, child.Hash) {
+		t.Error("the branch of the block is not the main chain after its mutated copy was rejected")
+	}
+}
+
+func TestAddBlockRejectsDuplicateCoinbases(t *testing.T) {
+	defer useTestDir(t)()
+
+	wallet := NewWallet()
+	address := string(wallet.GetAddress())
+	bc, err := CreateBlockchain(address, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.Close()
+
+	genesis, err := bc.GetBlock(bc.tip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// coinbases with the same data and reward to the same address have the same ID
+	coinbase := NewCoinbaseTX(address, "same data")
+	first := nextBlock(t, bc, bc.tip, coinbase)
+	if err := bc.AddBlock(first); err != nil {
+		t.Fatal(err)
+	}
+
+	duplicate := nextBlock(t, bc, first.Hash, NewCoinbaseTX(address, "same data"))
+	if err := bc.AddBlock(duplicate); !errors.Is(err, ErrInvalidBlock) {
+		t.Errorf("block repeating a coinbase with unspent outputs: got %v, want %v", err, ErrInvalidBlock)
+	}
+	if !bytes.Equal(bc.tip, first.Hash) || balanceOf(bc, wallet) != 2*subsidy {
+		t.Errorf("tip %x and balance %d after the duplicate, want %x and %d", bc.tip, balanceOf(bc, wallet), first.Hash, 2*subsidy)
+	}
+
+	// on a branch, the duplicate is found when the branch is connected
+	b1 := branchBlock(genesis, NewCoinbaseTX(address, "same data"))
+	b2 := branchBlock(b1, NewCoinbaseTX(address, "same data"))
+	if err := bc.AddBlock(b1); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.AddBlock(b2); !errors.Is(err, ErrInvalidBlock) {
+		t.Errorf("branch repeating a coinbase with unspent outputs: got %v, want %v", err, ErrInvalidBlock)
+	}
+	if !bytes.Equal(bc.tip, first.Hash) || balanceOf(bc, wallet) != 2*subsidy {
+		t.Errorf("tip %x and balance %d after the branch, want %x and %d", bc.tip, balanceOf(bc, wallet), first.Hash, 2*subsidy)
+	}
+	if _, err := bc.Validate(false); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNewBlockchainRefusesBadDatabases(t *testing.T) {
+	defer useTestDir(t)()
+
+	if _, err := NewBlockchain("missing"); !errors.Is(err, ErrBlockchainNotFound) {
+		t.Errorf("missing database: got %v, want %v", err, ErrBlockchainNotFound)
+	}
+
+	address := string(NewWallet().GetAddress())
+	tests := []struct {
+		nodeID string
+		edit   func(tx *bolt.Tx) error
+		want   error
+	}{
+		{"old", func(tx *bolt.Tx) error {
+			return tx.Bucket([]byte(metaBucket)).Put(versionKey, IntToHex(dbVersion-1))
+		}, ErrIncompatibleDB},
+		{"nometa", func(tx *bolt.Tx) error { return tx.DeleteBucket([]byte(metaBucket)) }, ErrIncompatibleDB},
+		{"notip", func(tx *bolt.Tx) error { return tx.Bucket([]byte(blocksBucket)).Delete(tipKey) }, ErrCorruptedDB},
+		{"noheights", func(tx *bolt.Tx) error { return tx.DeleteBucket([]byte(heightsBucket)) }, ErrCorruptedDB},
+	}
+	for _, test := range tests {
+		bc, err := CreateBlockchain(address, "", test.nodeID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = bc.db.Update(test.edit)
+		bc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := NewBlockchain(test.nodeID); !errors.Is(err, test.want) {
+			t.Errorf("%s: got %v, want %v", test.nodeID, err, test.want)
+		}
+	}
+
+	// a file that is not a bolt database at all
+	garbage := make([]byte, 8192)
+	for i := range garbage {
+		garbage[i] = byte(i)
+	}
+	if err := ioutil.WriteFile(dbPath("garbage"), garbage, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewBlockchain("garbage"); !errors.Is(err, ErrCorruptedDB) {
+		t.Errorf("garbage file: got %v, want %v", err, ErrCorruptedDB)
+	}
+
+	// a sound database opens at its tip, as many times as needed
+	bc, err := CreateBlockchain(address, "", "sound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tip := bc.tip
+	bc.Close()
+	for i := 0; i < 2; i++ {
+		bc, err := NewBlockchain("sound")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(bc.tip, tip) {
+			t.Errorf("opened at %x, want %x", bc.tip, tip)
+		}
+		bc.Close()
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// ChainValidationError describes the first invalid block found by Blockchain.Validate
+type ChainValidationError struct {
+	Height int
+	Hash   []byte
+	Reason string
+}
+
+func (e *ChainValidationError) Error() string {
+	return fmt.Sprintf("block %x at height %d is invalid: %s", e.Hash, e.Height, e.Reason)
+}
+
+// Validate walks the chain from the genesis block to the tip and checks every block
+// In fast mode only the headers are checked: the links between blocks, the targets, the timestamps and the proofs
+// of work.
+// Otherwise transactions are checked too: their IDs, signatures, lock times, that no output is spent twice and
+// that coinbases don't pay more than the subsidy and the fees.
+// It returns the number of blocks checked and a *ChainValidationError for the first invalid block
+func (bc *Blockchain) Validate(fast bool) (int, error) {
+	hashes := bc.GetBlockHashes()
+
+	// window holds the last retargetInterval blocks, to compute the expected targets
+	var window []*Block
+	// unspent holds the outputs not spent yet, keyed by outpoint, and txs all the transactions seen
+	unspent := make(map[string]TxOutput)
+	txs := make(map[string]Transaction)
+	// timestamps holds the timestamps of the last medianTimeSpan blocks, points where each transaction is
+	timestamps := []int64{}
+	points := make(map[string]chainPoint)
+	// the signatures commit to the first block, the hashes go from the tip down to it
+	genesis := hashes[len(hashes)-1]
+
+	var prev *Block
+	for height := len(hashes) - 1; height >= 0; height-- {
+		block, err := bc.GetBlock(hashes[height])
+		if err != nil {
+			return 0, err
+		}
+		blockHeight := len(hashes) - 1 - height
+
+		invalid := func(format string, a ...interface{}) (int, error) {
+			return blockHeight, &ChainValidationError{blockHeight, block.Hash, fmt.Sprintf(format, a...)}
+		}
+
+		if prev == nil {
+			if len(block.PrevBlockHash) != 0 {
+				return invalid("the first block has a parent %x", block.PrevBlockHash)
+			}
+		} else if bytes.Compare(block.PrevBlockHash, prev.Hash) != 0 {
+			return invalid("previous block hash is %x, expected %x", block.PrevBlockHash, prev.Hash)
+		}
+
+		target := maxTarget()
+		if prev != nil {
+			target = new(big.Int).SetBytes(prev.Target)
+			if blockHeight%retargetInterval == 0 {
+				target = targetAfterInterval(window[0], prev)
+			}
+		}
+		if new(big.Int).SetBytes(block.Target).Cmp(target) != 0 {
+			return invalid("target is %x, expected %x", block.Target, target)
+		}
+		if block.Height != blockHeight {
+			return invalid("height is %d, expected %d", block.Height, blockHeight)
+		}
+		if ahead := block.Timestamp - time.Now().Unix(); ahead > maxFutureBlockTime {
+			return invalid("timestamp is %d seconds in the future", ahead)
+		}
+		if median := medianTime(timestamps); prev != nil && block.Timestamp <= median {
+			return invalid("timestamp %d is not after the median time %d", block.Timestamp, median)
+		}
+		if len(block.Transactions) == 0 {
+			return invalid("block has no transactions")
+		}
+		if txID := block.DuplicateTransaction(); txID != nil {
+			return invalid("transaction %x is repeated", txID)
+		}
+		if !NewProofOfWork(block).Validate() {
+			return invalid("proof of work doesn't match the hash")
+		}
+
+		if !fast {
+			at := chainPoint{blockHeight, medianTime(timestamps)}
+			reason := connectTransactions(block, at, genesis, unspent, txs, points)
+			if reason != "" {
+				return invalid("%s", reason)
+			}
+		}
+
+		window = append(window, block)
+		if len(window) > retargetInterval {
+			window = window[1:]
+		}
+		timestamps = append(timestamps, block.Timestamp)
+		if len(timestamps) > medianTimeSpan {
+			timestamps = timestamps[1:]
+		}
+		prev = block
+	}
+
+	return len(hashes), nil
+}
+
+// connectTransactions checks the transactions of a block at point at against the outputs left unspent by the
+// previous blocks, then spends their inputs and adds their outputs. Signatures are checked for the chain starting
+// with the block genesis, and points holds where the transactions seen are, for the relative locks. It returns
+// why the block is invalid, or ""
+func connectTransactions(block *Block, at chainPoint, genesis []byte, unspent map[string]TxOutput, txs map[string]Transaction, points map[string]chainPoint) string {
+	fees := 0
+
+	for i, tx := range block.Transactions {
+		if bytes.Compare(tx.ID, tx.Hash()) != 0 {
+			return fmt.Sprintf("transaction %d has ID %x, expected %x", i, tx.ID, tx.Hash())
+		}
+		if tx.isCoinbase() != (i == 0) {
+			return fmt.Sprintf("transaction %x: only the first transaction must be a coinbase", tx.ID)
+		}
+
+		if !tx.isCoinbase() {
+			prevTxs := make(map[string]Transaction)
+			spentAt := make([]chainPoint, len(tx.Vin))
+
+			for inID, vin := range tx.Vin {
+				key := outpoint(vin.Txid, vin.Vout)
+				if _, ok := unspent[key]; !ok {
+					return fmt.Sprintf("transaction %x input %d spends %s, which is spent or doesn't exist", tx.ID, inID, key)
+				}
+				delete(unspent, key)
+
+				prevTxID := hex.EncodeToString(vin.Txid)
+				prevTxs[prevTxID] = txs[prevTxID]
+				spentAt[inID] = points[prevTxID]
+			}
+
+			fee, err := transactionFee(tx, prevTxs)
+			if err != nil {
+				return err.Error()
+			}
+			fees += fee
+
+			if !tx.Verify(prevTxs, block.Height, genesis) {
+				return fmt.Sprintf("transaction %x has an invalid signature", tx.ID)
+			}
+			if err := checkLockTimes(tx, at, spentAt); err != nil {
+				return fmt.Sprintf("transaction %x: %v", tx.ID, err)
+			}
+		}
+
+		// like AddBlock, only a transaction with unspent outputs can't be repeated, its outputs would be overwritten
+		for outIdx := range tx.Vout {
+			if _, ok := unspent[outpoint(tx.ID, outIdx)]; ok {
+				return fmt.Sprintf("transaction %x already has unspent outputs", tx.ID)
+			}
+		}
+		txID := hex.EncodeToString(tx.ID)
+		txs[txID] = *tx
+		points[txID] = at
+		for outIdx, out := range tx.Vout {
+			unspent[outpoint(tx.ID, outIdx)] = out
+		}
+	}
+
+	if err := checkReward(block.Transactions[0], fees); err != nil {
+		return err.Error()
+	}
+
+	return ""
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/boltdb/bolt"
+)
+
+// appendBlock stores a block as the new tip without any check, like a manual edit of the database would
+func appendBlock(t *testing.T, bc *Blockchain, block *Block) {
+	err := bc.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(blocksBucket))
+		err := b.Put(block.Hash, block.Serialize())
+		if err != nil {
+			return err
+		}
+		return bc.setTip(tx, block)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateChain(t *testing.T) {
+	defer useTestDir(t)()
+
+	wallet := NewWallet()
+	address := string(wallet.GetAddress())
+	bc, err := CreateBlockchain(address, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.Close()
+
+	// cross a retarget so the expected targets are checked too
+	UTXOSet := UTXOSet{bc}
+	bob := string(NewWallet().GetAddress())
+	for i := 0; i < retargetInterval; i++ {
+		tx := NewUTXOTransaction(wallet, bob, 1, 1, &UTXOSet)
+		bc.MineBlock([]*Transaction{NewRewardTX(address, "", subsidy+1), tx})
+	}
+
+	for _, fast := range []bool{true, false} {
+		checked, err := bc.Validate(fast)
+		if err != nil || checked != retargetInterval+1 {
+			t.Errorf("Validate(%v) = %d, %v, want %d blocks", fast, checked, err, retargetInterval+1)
+		}
+	}
+
+	// a block spending the genesis reward again passes the header checks only
+	genesis, err := bc.GetBlock(bc.GetBlockHashes()[retargetInterval])
+	if err != nil {
+		t.Fatal(err)
+	}
+	double := spendOutput(bc, wallet, genesis.Transactions[0].ID, 0, subsidy, bob)
+	block := nextBlock(t, bc, bc.tip, NewCoinbaseTX(address, ""), double)
+	appendBlock(t, bc, block)
+
+	if _, err := bc.Validate(true); err != nil {
+		t.Errorf("fast validation: %v", err)
+	}
+	checked, err := bc.Validate(false)
+	verr, ok := err.(*ChainValidationError)
+	if !ok {
+		t.Fatalf("full validation: got %v, want a ChainValidationError", err)
+	}
+	if checked != retargetInterval+1 || verr.Height != retargetInterval+1 || !bytes.Equal(verr.Hash, block.Hash) {
+		t.Errorf("full validation reported %v after %d blocks", verr, checked)
+	}
+}
+
+func TestValidateChainRejectsTamperedBlocks(t *testing.T) {
+	defer useTestDir(t)()
+
+	address := string(NewWallet().GetAddress())
+	bc, err := CreateBlockchain(address, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.Close()
+
+	bc.MineBlock([]*Transaction{NewCoinbaseTX(address, "")})
+	tip, err := bc.GetBlock(bc.tip)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// changing a mined block breaks its proof of work
+	tip.Transactions[0] = NewCoinbaseTX(address, "")
+	appendBlock(t, bc, tip)
+
+	_, err = bc.Validate(true)
+	if verr, ok := err.(*ChainValidationError); !ok || verr.Height != 1 {
+		t.Errorf("got %v, want an error at height 1", err)
+	}
+}
+
+func TestValidateChainRejectsInflation(t *testing.T) {
+	defer useTestDir(t)()
+
+	wallet := NewWallet()
+	address := string(wallet.GetAddress())
+
+	negativeCoinbase := func(bc *Blockchain) []*Transaction {
+		coinbase := NewRewardTX(address, "", 1000)
+		coinbase.Vout = append(coinbase.Vout, TxOutput{-990, HashPubKey(wallet.PublicKey), false, nil})
+		coinbase.ID = coinbase.Hash()
+		return []*Transaction{coinbase}
+	}
+	overflowingOutputs := func(bc *Blockchain) []*Transaction {
+		genesis, err := bc.GetBlock(bc.tip)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx := spendOutput(bc, wallet, genesis.Transactions[0].ID, 0, subsidy, address)
+		tx.Vout = []TxOutput{*NewTxOutput(math.MaxInt64, address), *NewTxOutput(math.MaxInt64, address), *NewTxOutput(2, address)}
+		bc.SignTransaction(tx, wallet.PrivateKey)
+		tx.ID = tx.Hash()
+		return []*Transaction{NewCoinbaseTX(address, ""), tx}
+	}
+
+	for nodeID, txs := range map[string]func(*Blockchain) []*Transaction{"negative": negativeCoinbase, "overflow": overflowingOutputs} {
+		bc, err := CreateBlockchain(address, "", nodeID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		appendBlock(t, bc, nextBlock(t, bc, bc.tip, txs(bc)...))
+
+		_, err = bc.Validate(false)
+		if verr, ok := err.(*ChainValidationError); !ok || verr.Height != 1 {
+			t.Errorf("%s: got %v, want an error at height 1", nodeID, err)
+		}
+		bc.Close()
+	}
+}
+
+func TestValidateChainAgreesWithAddBlockOnRepeatedTransactions(t *testing.T) {
+	defer useTestDir(t)()
+
+	alice := NewWallet()
+	address := string(alice.GetAddress())
+	bob := string(NewWallet().GetAddress())
+
+	for _, spent := range []bool{true, false} {
+		nodeID := fmt.Sprintf("spent-%v", spent)
+		bc, err := CreateBlockchain(address, "", nodeID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// coinbases with the same data and reward to the same address have the same ID
+		coinbase := NewCoinbaseTX(address, "same data")
+		block := nextBlock(t, bc, bc.tip, coinbase)
+		if err := bc.AddBlock(block); err != nil {
+			t.Fatal(err)
+		}
+		if spent {
+			block = nextBlock(t, bc, bc.tip, NewCoinbaseTX(address, ""), spendOutput(bc, alice, coinbase.ID, 0, subsidy, bob))
+			if err := bc.AddBlock(block); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		repeated := nextBlock(t, bc, bc.tip, NewCoinbaseTX(address, "same data"))
+		added := bc.AddBlock(repeated) == nil
+		if !added {
+			appendBlock(t, bc, repeated)
+		}
+		_, err = bc.Validate(false)
+		if added != (err == nil) || added != spent {
+			t.Errorf("%s: AddBlock accepted the block %v, Validate returned %v", nodeID, added, err)
+		}
+		bc.Close()
+	}
+}
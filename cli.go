@@ -17,6 +17,9 @@ type CLI struct {
 func (cli *CLI) Run() {
 	cli.validateArgs()
 
+	// every node keeps its own blockchain, NODE_ID also is the port startnode listens on
+	nodeID := os.Getenv("NODE_ID")
+
 	// flag sets
 	getBalanceCmd := flag.NewFlagSet("getbalance", flag.ExitOnError)
 	createBlockchainCmd := flag.NewFlagSet("createblockchain", flag.ExitOnError)
@@ -24,12 +27,101 @@ func (cli *CLI) Run() {
 	listAddressesCmd := flag.NewFlagSet("listaddresses", flag.ExitOnError)
 	sendCmd := flag.NewFlagSet("send", flag.ExitOnError)
 	printChainCmd := flag.NewFlagSet("printchain", flag.ExitOnError)
+	reindexUTXOCmd := flag.NewFlagSet("reindexutxo", flag.ExitOnError)
+	startNodeCmd := flag.NewFlagSet("startnode", flag.ExitOnError)
+	validateChainCmd := flag.NewFlagSet("validatechain", flag.ExitOnError)
+	getBlockCmd := flag.NewFlagSet("getblock", flag.ExitOnError)
+	getBlockCountCmd := flag.NewFlagSet("getblockcount", flag.ExitOnError)
+	getTransactionCmd := flag.NewFlagSet("gettransaction", flag.ExitOnError)
+	reindexTxCmd := flag.NewFlagSet("reindextx", flag.ExitOnError)
+	listTransactionsCmd := flag.NewFlagSet("listtransactions", flag.ExitOnError)
+	reindexAddrCmd := flag.NewFlagSet("reindexaddr", flag.ExitOnError)
+	encryptWalletCmd := flag.NewFlagSet("encryptwallet", flag.ExitOnError)
+	changePassphraseCmd := flag.NewFlagSet("changepassphrase", flag.ExitOnError)
+	restoreWalletCmd := flag.NewFlagSet("restorewallet", flag.ExitOnError)
+	dumpPrivKeyCmd := flag.NewFlagSet("dumpprivkey", flag.ExitOnError)
+	importPrivKeyCmd := flag.NewFlagSet("importprivkey", flag.ExitOnError)
+	watchAddressCmd := flag.NewFlagSet("watchaddress", flag.ExitOnError)
+	createRawTxCmd := flag.NewFlagSet("createrawtransaction", flag.ExitOnError)
+	signRawTxCmd := flag.NewFlagSet("signrawtransaction", flag.ExitOnError)
+	sendRawTxCmd := flag.NewFlagSet("sendrawtransaction", flag.ExitOnError)
+	signMessageCmd := flag.NewFlagSet("signmessage", flag.ExitOnError)
+	verifyMessageCmd := flag.NewFlagSet("verifymessage", flag.ExitOnError)
+	createMultisigCmd := flag.NewFlagSet("createmultisig", flag.ExitOnError)
+	htlcCreateCmd := flag.NewFlagSet("htlc create", flag.ExitOnError)
+	htlcRedeemCmd := flag.NewFlagSet("htlc redeem", flag.ExitOnError)
+	htlcRefundCmd := flag.NewFlagSet("htlc refund", flag.ExitOnError)
+	htlcSecretCmd := flag.NewFlagSet("htlc secret", flag.ExitOnError)
 
 	getBalanceData := getBalanceCmd.String("address", "", "address to get balance")
 	createBlockchainData := createBlockchainCmd.String("address", "", "Address of transaction")
+	createBlockchainGenesis := createBlockchainCmd.String("genesis", "", "Coinbase data of the genesis block, telling this chain apart from others")
+	createBlockchainTxIndex := createBlockchainCmd.Bool("txindex", false, "Keep an index of the transactions by ID")
+	createBlockchainAddrIndex := createBlockchainCmd.Bool("addrindex", false, "Keep an index of the transactions by address")
 	sendFrom := sendCmd.String("from", "", "from who")
 	sendTo := sendCmd.String("to", "", "send to")
 	sendAmount := sendCmd.String("amount", "", "Amount to send")
+	sendFee := sendCmd.Int("fee", 0, "Fee paid to the miner")
+	sendFeeRate := sendCmd.Int("feerate", 0, "Fee paid to the miner per byte of the transaction, instead of -fee")
+	sendNode := sendCmd.String("node", "", "Submit the transaction to the node at this address instead of mining it")
+	sendBatch := sendCmd.String("batch", "", "CSV or JSON file of the addresses and amounts to pay, instead of -to and -amount")
+	sendCoinSelect := sendCmd.String("coinselect", defaultCoinSelector, "Strategy picking the outputs to spend: largest, smallest, bnb or random")
+	sendDryRun := sendCmd.Bool("dryrun", false, "Show the inputs, change and size of the transaction without sending it")
+	sendLockTime := sendCmd.Int("locktime", 0, "Block height, or Unix time from 500000000 on, the transaction can't be mined before")
+	startNodeMiner := startNodeCmd.String("miner", "", "Enable mining mode and send reward to ADDRESS")
+	startNodeSeeds := startNodeCmd.String("seeds", defaultSeed, "Comma separated addresses of the nodes to connect to")
+	validateChainFast := validateChainCmd.Bool("fast", false, "Only check the block headers and proofs of work")
+	startNodeMaxBlockTxs := startNodeCmd.Int("maxblocktxs", defaultMaxBlockTxs, "Maximum number of transactions from the mempool in a mined block")
+	getBlockHash := getBlockCmd.String("hash", "", "Hash of the block")
+	getBlockHeight := getBlockCmd.Int("height", -1, "Height of the block in the main chain, instead of -hash")
+	getTransactionID := getTransactionCmd.String("id", "", "ID of the transaction")
+	listTransactionsAddress := listTransactionsCmd.String("address", "", "Address to list the transactions of")
+	listTransactionsCount := listTransactionsCmd.Int("count", 10, "Number of transactions to list")
+	listTransactionsSkip := listTransactionsCmd.Int("skip", 0, "Number of most recent transactions to skip")
+	restoreWalletMnemonic := restoreWalletCmd.String("mnemonic", "", "Words of the mnemonic of the seed, separated by spaces")
+	dumpPrivKeyAddress := dumpPrivKeyCmd.String("address", "", "Address to export the private key of")
+	importPrivKeyKey := importPrivKeyCmd.String("key", "", "Private key exported by dumpprivkey")
+	importPrivKeyRescan := importPrivKeyCmd.Bool("rescan", false, "Search the blockchain for the transactions of the imported address")
+	watchAddressAddress := watchAddressCmd.String("address", "", "Address to watch")
+	watchAddressPubKey := watchAddressCmd.String("pubkey", "", "Hex encoded public key of the address to watch, instead of -address")
+	createRawTxFrom := createRawTxCmd.String("from", "", "Address to spend from")
+	createRawTxTo := createRawTxCmd.String("to", "", "Address to pay")
+	createRawTxAmount := createRawTxCmd.Int("amount", 0, "Amount to pay")
+	createRawTxBatch := createRawTxCmd.String("batch", "", "CSV or JSON file of the addresses and amounts to pay, instead of -to and -amount")
+	createRawTxFee := createRawTxCmd.Int("fee", 0, "Fee paid to the miner")
+	createRawTxCoinSelect := createRawTxCmd.String("coinselect", defaultCoinSelector, "Strategy picking the outputs to spend: largest, smallest, bnb or random")
+	createRawTxOut := createRawTxCmd.String("out", "", "File to write the unsigned transaction to")
+	signRawTxIn := signRawTxCmd.String("in", "", "File of the transaction to sign")
+	signRawTxOut := signRawTxCmd.String("out", "", "File to write the signed transaction to, -in by default")
+	sendRawTxIn := sendRawTxCmd.String("in", "", "File of the signed transaction")
+	sendRawTxNode := sendRawTxCmd.String("node", "", "Submit the transaction to the node at this address instead of mining it")
+	sendRawTxMiner := sendRawTxCmd.String("miner", "", "Address receiving the reward of the block mined locally")
+	signMessageAddress := signMessageCmd.String("address", "", "Address whose key signs the message")
+	signMessageMessage := signMessageCmd.String("message", "", "Message to sign")
+	verifyMessageAddress := verifyMessageCmd.String("address", "", "Address expected to have signed the message")
+	verifyMessageSignature := verifyMessageCmd.String("signature", "", "Signature printed by signmessage")
+	verifyMessageMessage := verifyMessageCmd.String("message", "", "Signed message")
+	createMultisigRequired := createMultisigCmd.Int("required", 0, "Number of signatures needed to spend from the address")
+	createMultisigPubKeys := createMultisigCmd.String("pubkeys", "", "Comma separated hex encoded public keys allowed to sign")
+	listAddressesPubKeys := listAddressesCmd.Bool("pubkeys", false, "Print the hex encoded public key of every address")
+	htlcCreateFrom := htlcCreateCmd.String("from", "", "Address locking the coins, refunded after the timeout")
+	htlcCreateTo := htlcCreateCmd.String("to", "", "Address redeeming the coins with the secret")
+	htlcCreateAmount := htlcCreateCmd.Int("amount", 0, "Amount to lock")
+	htlcCreateHash := htlcCreateCmd.String("hash", "", "Hex encoded SHA-256 hash of the secret, a new secret is drawn without it")
+	htlcCreateTimeout := htlcCreateCmd.Int("timeout", defaultHTLCTimeout, "Number of blocks before the sender can take the coins back")
+	htlcCreateFee := htlcCreateCmd.Int("fee", 0, "Fee paid to the miner")
+	htlcCreateNode := htlcCreateCmd.String("node", "", "Submit the transaction to the node at this address instead of mining it")
+	htlcRedeemTxID := htlcRedeemCmd.String("txid", "", "ID of the transaction with the contract")
+	htlcRedeemVout := htlcRedeemCmd.Int("vout", 0, "Output of the contract")
+	htlcRedeemSecret := htlcRedeemCmd.String("secret", "", "Hex encoded secret of the contract")
+	htlcRedeemFee := htlcRedeemCmd.Int("fee", 0, "Fee paid to the miner")
+	htlcRedeemNode := htlcRedeemCmd.String("node", "", "Submit the transaction to the node at this address instead of mining it")
+	htlcRefundTxID := htlcRefundCmd.String("txid", "", "ID of the transaction with the contract")
+	htlcRefundVout := htlcRefundCmd.Int("vout", 0, "Output of the contract")
+	htlcRefundFee := htlcRefundCmd.Int("fee", 0, "Fee paid to the miner")
+	htlcRefundNode := htlcRefundCmd.String("node", "", "Submit the transaction to the node at this address instead of mining it")
+	htlcSecretTxID := htlcSecretCmd.String("txid", "", "ID of the transaction with the contract")
+	htlcSecretVout := htlcSecretCmd.Int("vout", 0, "Output of the contract")
 
 	switch os.Args[1] {
 	case "printchain":
@@ -62,6 +154,133 @@ func (cli *CLI) Run() {
 		if err != nil {
 			log.Panic(err)
 		}
+	case "reindexutxo":
+		err := reindexUTXOCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "startnode":
+		err := startNodeCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "validatechain":
+		err := validateChainCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "getblock":
+		err := getBlockCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "getblockcount":
+		err := getBlockCountCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "gettransaction":
+		err := getTransactionCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "reindextx":
+		err := reindexTxCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "listtransactions":
+		err := listTransactionsCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "reindexaddr":
+		err := reindexAddrCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "encryptwallet":
+		err := encryptWalletCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "changepassphrase":
+		err := changePassphraseCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "restorewallet":
+		err := restoreWalletCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "dumpprivkey":
+		err := dumpPrivKeyCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "importprivkey":
+		err := importPrivKeyCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "watchaddress":
+		err := watchAddressCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "createrawtransaction":
+		err := createRawTxCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "signrawtransaction":
+		err := signRawTxCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "sendrawtransaction":
+		err := sendRawTxCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "signmessage":
+		err := signMessageCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "verifymessage":
+		err := verifyMessageCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "createmultisig":
+		err := createMultisigCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "htlc":
+		if len(os.Args) < 3 {
+			cli.printUsage()
+			os.Exit(1)
+		}
+		var err error
+		switch os.Args[2] {
+		case "create":
+			err = htlcCreateCmd.Parse(os.Args[3:])
+		case "redeem":
+			err = htlcRedeemCmd.Parse(os.Args[3:])
+		case "refund":
+			err = htlcRefundCmd.Parse(os.Args[3:])
+		case "secret":
+			err = htlcSecretCmd.Parse(os.Args[3:])
+		default:
+			cli.printUsage()
+			os.Exit(1)
+		}
+		if err != nil {
+			log.Panic(err)
+		}
 	default:
 		cli.printUsage()
 		os.Exit(1)
@@ -72,38 +291,252 @@ func (cli *CLI) Run() {
 			createBlockchainCmd.Usage()
 			os.Exit(1)
 		}
-		cli.createBlockchain(*createBlockchainData)
+		cli.createBlockchain(*createBlockchainData, *createBlockchainGenesis, *createBlockchainTxIndex, *createBlockchainAddrIndex, nodeID)
 	}
 	if getBalanceCmd.Parsed() {
-		if *getBalanceData == "" {
+		if !ValidateAddress(*getBalanceData) {
 			getBalanceCmd.Usage()
 			os.Exit(1)
 		}
-		cli.getBalance(*getBalanceData)
+		cli.getBalance(*getBalanceData, nodeID)
 	}
 	if sendCmd.Parsed() {
-		if *sendFrom == "" || *sendTo == "" || *sendAmount == "" {
+		if *sendFrom == "" || (*sendBatch == "") == (*sendTo == "" || *sendAmount == "") {
 			sendCmd.Usage()
 			os.Exit(1)
 		}
-		amountToSend, _ := strconv.Atoi(*sendAmount)
-		cli.send(*sendFrom, *sendTo, amountToSend)
+		if *sendFee < 0 || *sendFeeRate < 0 || (*sendFee > 0 && *sendFeeRate > 0) || *sendLockTime < 0 {
+			sendCmd.Usage()
+			os.Exit(1)
+		}
+		var payments []Payment
+		if *sendBatch != "" {
+			var err error
+			payments, err = readPayments(*sendBatch)
+			if err != nil {
+				log.Panic(err)
+			}
+		} else {
+			amountToSend, _ := strconv.Atoi(*sendAmount)
+			payments = []Payment{{*sendTo, amountToSend}}
+		}
+		cli.send(*sendFrom, payments, *sendFee, *sendFeeRate, *sendLockTime, *sendCoinSelect, *sendDryRun, *sendNode, nodeID)
 	}
 	if printChainCmd.Parsed() {
-		cli.printChain()
+		cli.printChain(nodeID)
 	}
 	if createWalletCmd.Parsed() {
 		cli.createWallet()
 	}
 	if listAddressesCmd.Parsed() {
-		cli.listAddresses()
+		cli.listAddresses(*listAddressesPubKeys)
+	}
+	if reindexUTXOCmd.Parsed() {
+		cli.reindexUTXO(nodeID)
+	}
+	if validateChainCmd.Parsed() {
+		cli.validateChain(*validateChainFast, nodeID)
+	}
+	if getBlockCmd.Parsed() {
+		if (*getBlockHash == "") == (*getBlockHeight < 0) {
+			getBlockCmd.Usage()
+			os.Exit(1)
+		}
+		cli.getBlock(*getBlockHash, *getBlockHeight, nodeID)
+	}
+	if getBlockCountCmd.Parsed() {
+		cli.getBlockCount(nodeID)
+	}
+	if getTransactionCmd.Parsed() {
+		if *getTransactionID == "" {
+			getTransactionCmd.Usage()
+			os.Exit(1)
+		}
+		cli.getTransaction(*getTransactionID, nodeID)
+	}
+	if reindexTxCmd.Parsed() {
+		cli.reindexTransactions(nodeID)
+	}
+	if listTransactionsCmd.Parsed() {
+		if !ValidateAddress(*listTransactionsAddress) || *listTransactionsCount < 1 || *listTransactionsSkip < 0 {
+			listTransactionsCmd.Usage()
+			os.Exit(1)
+		}
+		cli.listTransactions(*listTransactionsAddress, *listTransactionsCount, *listTransactionsSkip, nodeID)
+	}
+	if reindexAddrCmd.Parsed() {
+		cli.reindexAddresses(nodeID)
+	}
+	if encryptWalletCmd.Parsed() {
+		cli.encryptWallet()
+	}
+	if changePassphraseCmd.Parsed() {
+		cli.changePassphrase()
+	}
+	if restoreWalletCmd.Parsed() {
+		if *restoreWalletMnemonic == "" {
+			restoreWalletCmd.Usage()
+			os.Exit(1)
+		}
+		cli.restoreWallet(*restoreWalletMnemonic, nodeID)
+	}
+	if dumpPrivKeyCmd.Parsed() {
+		if *dumpPrivKeyAddress == "" {
+			dumpPrivKeyCmd.Usage()
+			os.Exit(1)
+		}
+		cli.dumpPrivKey(*dumpPrivKeyAddress)
+	}
+	if importPrivKeyCmd.Parsed() {
+		if *importPrivKeyKey == "" {
+			importPrivKeyCmd.Usage()
+			os.Exit(1)
+		}
+		cli.importPrivKey(*importPrivKeyKey, *importPrivKeyRescan, nodeID)
+	}
+	if watchAddressCmd.Parsed() {
+		if (*watchAddressAddress == "") == (*watchAddressPubKey == "") {
+			watchAddressCmd.Usage()
+			os.Exit(1)
+		}
+		cli.watchAddress(*watchAddressAddress, *watchAddressPubKey)
+	}
+	if createRawTxCmd.Parsed() {
+		if *createRawTxFrom == "" || *createRawTxOut == "" || *createRawTxFee < 0 || (*createRawTxBatch == "") == (*createRawTxTo == "") {
+			createRawTxCmd.Usage()
+			os.Exit(1)
+		}
+		payments := []Payment{{*createRawTxTo, *createRawTxAmount}}
+		if *createRawTxBatch != "" {
+			var err error
+			payments, err = readPayments(*createRawTxBatch)
+			if err != nil {
+				log.Panic(err)
+			}
+		}
+		cli.createRawTransaction(*createRawTxFrom, payments, *createRawTxFee, *createRawTxCoinSelect, *createRawTxOut, nodeID)
+	}
+	if signRawTxCmd.Parsed() {
+		if *signRawTxIn == "" {
+			signRawTxCmd.Usage()
+			os.Exit(1)
+		}
+		if *signRawTxOut == "" {
+			*signRawTxOut = *signRawTxIn
+		}
+		cli.signRawTransaction(*signRawTxIn, *signRawTxOut)
+	}
+	if sendRawTxCmd.Parsed() {
+		if *sendRawTxIn == "" || (*sendRawTxNode == "") == (*sendRawTxMiner == "") {
+			sendRawTxCmd.Usage()
+			os.Exit(1)
+		}
+		cli.sendRawTransaction(*sendRawTxIn, *sendRawTxNode, *sendRawTxMiner, nodeID)
+	}
+	if signMessageCmd.Parsed() {
+		if *signMessageAddress == "" {
+			signMessageCmd.Usage()
+			os.Exit(1)
+		}
+		cli.signMessage(*signMessageAddress, *signMessageMessage)
+	}
+	if verifyMessageCmd.Parsed() {
+		if *verifyMessageAddress == "" || *verifyMessageSignature == "" {
+			verifyMessageCmd.Usage()
+			os.Exit(1)
+		}
+		cli.verifyMessage(*verifyMessageAddress, *verifyMessageSignature, *verifyMessageMessage)
+	}
+	if createMultisigCmd.Parsed() {
+		if *createMultisigRequired < 1 || *createMultisigPubKeys == "" {
+			createMultisigCmd.Usage()
+			os.Exit(1)
+		}
+		cli.createMultisig(*createMultisigRequired, *createMultisigPubKeys)
+	}
+	if htlcCreateCmd.Parsed() {
+		if *htlcCreateFrom == "" || *htlcCreateTo == "" || *htlcCreateAmount <= 0 || *htlcCreateTimeout < 1 || *htlcCreateFee < 0 {
+			htlcCreateCmd.Usage()
+			os.Exit(1)
+		}
+		cli.createHTLC(*htlcCreateFrom, *htlcCreateTo, *htlcCreateAmount, *htlcCreateHash, *htlcCreateTimeout, *htlcCreateFee, *htlcCreateNode, nodeID)
+	}
+	if htlcRedeemCmd.Parsed() {
+		if *htlcRedeemTxID == "" || *htlcRedeemSecret == "" || *htlcRedeemFee < 0 {
+			htlcRedeemCmd.Usage()
+			os.Exit(1)
+		}
+		cli.redeemHTLC(*htlcRedeemTxID, *htlcRedeemVout, *htlcRedeemSecret, *htlcRedeemFee, *htlcRedeemNode, nodeID)
+	}
+	if htlcRefundCmd.Parsed() {
+		if *htlcRefundTxID == "" || *htlcRefundFee < 0 {
+			htlcRefundCmd.Usage()
+			os.Exit(1)
+		}
+		cli.refundHTLC(*htlcRefundTxID, *htlcRefundVout, *htlcRefundFee, *htlcRefundNode, nodeID)
+	}
+	if htlcSecretCmd.Parsed() {
+		if *htlcSecretTxID == "" {
+			htlcSecretCmd.Usage()
+			os.Exit(1)
+		}
+		cli.htlcSecret(*htlcSecretTxID, *htlcSecretVout, nodeID)
+	}
+	if startNodeCmd.Parsed() {
+		if nodeID == "" {
+			startNodeCmd.Usage()
+			os.Exit(1)
+		}
+		if *startNodeMaxBlockTxs < 1 {
+			startNodeCmd.Usage()
+			os.Exit(1)
+		}
+		cli.startNode(nodeID, *startNodeMiner, *startNodeSeeds, *startNodeMaxBlockTxs)
 	}
 
 }
 
 func (cli *CLI) printUsage() {
-	fmt.Println("Add Block to Blockchain: Glockchain addblock [DATA]")
-	fmt.Println("Print blockchain: Glockchain printchain")
+	fmt.Println("Usage:")
+	fmt.Println("  createblockchain -address ADDRESS [-genesis DATA] [-txindex] [-addrindex] - Create a blockchain and send genesis block reward to ADDRESS, indexing transactions by ID with -txindex and by address with -addrindex")
+	fmt.Println("    DATA is the coinbase data of the genesis block. Transactions are signed for one chain, give different DATA to chains that must not share them")
+	fmt.Println("  changepassphrase - Encrypts the wallet file with a new passphrase")
+	fmt.Println("  createrawtransaction -from FROM -to TO -amount AMOUNT | -batch FILE [-fee FEE] [-coinselect STRATEGY] -out OUT - Write to OUT an unsigned transaction paying from FROM, which signrawtransaction signs without the blockchain. FROM may be a multisig address of the wallet file, signed in turn by its key holders")
+	fmt.Println("  createmultisig -required M -pubkeys KEYS - Add to the wallet file the address needing M signatures among the comma separated hex encoded public KEYS")
+	fmt.Println("  createwallet - Derives a new key-pair from the seed of the wallet file and saves it, creating the seed and printing its mnemonic the first time")
+	fmt.Println("  dumpprivkey -address ADDRESS - Print the private key of ADDRESS, in the Base58 format importprivkey reads")
+	fmt.Println("  encryptwallet - Encrypts the private keys of the wallet file with a passphrase")
+	fmt.Println("  getbalance -address ADDRESS - Get balance of ADDRESS")
+	fmt.Println("  getblock -hash HASH | -height HEIGHT - Print the block with HASH, or the block at HEIGHT in the main chain")
+	fmt.Println("  getblockcount - Print the height of the tip, the genesis block has height 0")
+	fmt.Println("  gettransaction -id ID - Print the transaction with ID and its number of confirmations")
+	fmt.Println("  htlc create -from FROM -to TO -amount AMOUNT [-hash HASH] [-timeout BLOCKS] [-fee FEE] [-node ADDRESS] - Lock AMOUNT from FROM in a contract TO redeems with the secret of HASH, or FROM takes back BLOCKS blocks later. Without HASH a secret is drawn and printed")
+	fmt.Println("  htlc redeem -txid ID [-vout N] -secret SECRET [-fee FEE] [-node ADDRESS] - Spend the contract output N of transaction ID with SECRET, to its recipient")
+	fmt.Println("  htlc refund -txid ID [-vout N] [-fee FEE] [-node ADDRESS] - Give the timed out contract output N of transaction ID back to its sender")
+	fmt.Println("  htlc secret -txid ID [-vout N] - Print the secret revealed by the transaction redeeming the contract output N of transaction ID")
+	fmt.Println("    Swap: A locks with a new secret, B locks on the other chain with its hash and a shorter timeout, A redeems there, B reads the secret with htlc secret and redeems")
+	fmt.Println("  importprivkey -key KEY [-rescan] - Add the private key KEY to the wallet file, and with -rescan search the blockchain for the transactions of its address")
+	fmt.Println("  listaddresses [-pubkeys] - Lists all addresses from the wallet file, watch-only and multisig ones marked as such, with their public keys with -pubkeys")
+	fmt.Println("  listtransactions -address ADDRESS [-count N] [-skip M] - List the N transactions of ADDRESS before the M most recent ones, with amounts, counterparties and running balance")
+	fmt.Println("  printchain - Print all the blocks of the blockchain")
+	fmt.Println("  reindexaddr - Builds the address index from the blocks and keeps it up to date from then on")
+	fmt.Println("  reindextx - Builds the transaction index from the blocks and keeps it up to date from then on")
+	fmt.Println("  reindexutxo - Rebuilds the UTXO set from the blocks")
+	fmt.Println("  restorewallet -mnemonic \"WORDS\" - Restores the seed of MNEMONIC into the wallet file, with every address of the seed used in the blockchain")
+	fmt.Println("  send -from FROM -to TO -amount AMOUNT [-fee FEE | -feerate RATE] [-coinselect STRATEGY] [-locktime LOCKTIME] [-dryrun] [-node ADDRESS] - Send AMOUNT of coins from FROM address to TO, paying FEE or RATE per byte to the miner. Mine the block locally, or submit the transaction to the node at ADDRESS")
+	fmt.Println("  send -from FROM -batch FILE [...] - Pay every ADDRESS,AMOUNT line of a CSV FILE, or every {address, amount} of a JSON FILE, in a single transaction")
+	fmt.Println("    STRATEGY picks the outputs to spend: largest (default), smallest, bnb for an exact match without change, or random. -dryrun shows the transaction without sending it")
+	fmt.Println("    LOCKTIME is the block height, or the Unix time from 500000000 on, the transaction can't be mined before. The node at ADDRESS keeps it until then")
+	fmt.Println("  sendrawtransaction -in FILE -miner MINER | -node ADDRESS - Check the signed transaction of FILE, then mine it locally with the reward paid to MINER or submit it to the node at ADDRESS")
+	fmt.Println("  signrawtransaction -in FILE [-out OUT] - Sign the inputs of the transaction of FILE the wallet file has the keys of, and write it to OUT or back to FILE")
+	fmt.Println("  signmessage -address ADDRESS -message MESSAGE - Sign MESSAGE with the key of ADDRESS, proving the wallet owns it")
+	fmt.Println("  startnode [-miner ADDRESS] [-seeds ADDRESSES] [-maxblocktxs N] - Start a node listening on the port NODE_ID, with mining enabled if ADDRESS is set")
+	fmt.Println("  validatechain [-fast] - Check every block from the genesis block to the tip, only the headers with -fast")
+	fmt.Println("  verifymessage -address ADDRESS -signature SIGNATURE -message MESSAGE - Check that SIGNATURE of MESSAGE was made with the key of ADDRESS")
+	fmt.Println("  watchaddress -address ADDRESS | -pubkey KEY - Track ADDRESS, or the address of the hex encoded public KEY, in the wallet file without its private key")
+	fmt.Println("NODE_ID selects the blockchain file of the node, blockchain_NODE_ID.db")
+	fmt.Println("Commands using private keys of an encrypted wallet ask for its passphrase, or read it from WALLET_PASSPHRASE")
+	fmt.Println("changepassphrase reads the new passphrase from WALLET_NEW_PASSPHRASE when it is set")
 }
 
 func (cli *CLI) validateArgs() {
@@ -5,11 +5,27 @@ import (
 	"log"
 )
 
-func (cli *CLI) createBlockchain(address string) {
+func (cli *CLI) createBlockchain(address, genesisData string, txIndex, addrIndex bool, nodeID string) {
 	if !ValidateAddress(address) {
 		log.Panic("ERROR: Address is not valid")
 	}
-	bc := NewBlockchain(address)
-	bc.db.Close()
+	bc, err := CreateBlockchain(address, genesisData, nodeID)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer bc.Close()
+
+	if txIndex {
+		err = bc.ReindexTransactions()
+		if err != nil {
+			log.Panic(err)
+		}
+	}
+	if addrIndex {
+		err = bc.ReindexAddresses()
+		if err != nil {
+			log.Panic(err)
+		}
+	}
 	fmt.Println("Done!")
 }
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// createMultisig adds to the wallet file the address requiring required signatures among the comma separated,
+// hex encoded, public keys of pubKeys
+func (cli *CLI) createMultisig(required int, pubKeys string) {
+	var keys [][]byte
+	for _, pubKey := range strings.Split(pubKeys, ",") {
+		key, err := hex.DecodeString(strings.TrimSpace(pubKey))
+		if err != nil {
+			log.Panicf("ERROR: Public key %q is not hex encoded", pubKey)
+		}
+		keys = append(keys, key)
+	}
+	policy, err := NewMultisig(required, keys)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	wallets, err := NewWallets()
+	if err != nil && !os.IsNotExist(err) {
+		log.Panic(err)
+	}
+	address, err := wallets.AddMultisig(policy)
+	if err != nil {
+		log.Panic(err)
+	}
+	err = wallets.SaveToFile()
+	if err != nil {
+		log.Panic(err)
+	}
+
+	fmt.Printf("Multisig address requiring %d of %d signatures: %s\n", policy.Required, len(policy.PubKeys), address)
+}
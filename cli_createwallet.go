@@ -2,12 +2,35 @@ package main
 
 import (
 	"fmt"
+	"log"
+	"os"
 )
 
 func (cli *CLI) createWallet() {
-	wallets, _ := NewWallets()
-	address := wallets.CreateWallet()
-	wallets.SaveToFile()
+	wallets, err := NewWallets()
+	if err != nil && !os.IsNotExist(err) {
+		log.Panic(err)
+	}
+	unlockWallets(wallets)
+
+	if !wallets.HasSeed() {
+		mnemonic, err := wallets.NewSeed()
+		if err != nil {
+			log.Panic(err)
+		}
+		fmt.Println("The addresses of this wallet are derived from a new seed. Write down its mnemonic,")
+		fmt.Println("restorewallet brings them back from it:")
+		fmt.Printf("  %s\n", mnemonic)
+	}
+
+	address, err := wallets.CreateWallet()
+	if err != nil {
+		log.Panic(err)
+	}
+	err = wallets.SaveToFile()
+	if err != nil {
+		log.Panic(err)
+	}
 
 	fmt.Printf("Your new address: %s\n", address)
 }
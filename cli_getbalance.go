@@ -5,21 +5,26 @@ import (
 	"log"
 )
 
-func (cli *CLI) getBalance(address string) {
-	if !ValidateAddress(address) {
-		log.Panic("ERROR: Address is not valid")
+func (cli *CLI) getBalance(address, nodeID string) {
+	bc, err := NewBlockchain(nodeID)
+	if err != nil {
+		log.Panic(err)
 	}
-	bc := NewBlockchain(address)
-	defer bc.db.Close()
+	defer bc.Close()
 
 	balance := 0
-	pubKeyHash := Base58Decode([]byte(address))
-	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-4]
-	UTXOs := bc.FindUTXO(pubKeyHash)
+	_, pubKeyHash := decodeAddress(address)
+	UTXOSet := UTXOSet{bc}
+	UTXOs := UTXOSet.FindUTXO(pubKeyHash)
 
 	for _, out := range UTXOs {
 		balance += out.Value
 	}
 
-	fmt.Printf("Balance of '%s': %d\n", address, balance)
+	// the wallet file is optional, it only tells whether the address is watch-only
+	marker := ""
+	if wallets, err := NewWallets(); err == nil && wallets.IsWatchOnly(address) {
+		marker = " (watch-only)"
+	}
+	fmt.Printf("Balance of '%s'%s: %d\n", address, marker, balance)
 }
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log"
+)
+
+// getBlock prints the block with the given hash, or the block of the main chain at height when hash is empty
+func (cli *CLI) getBlock(hash string, height int, nodeID string) {
+	bc, err := NewBlockchain(nodeID)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer bc.Close()
+
+	var block *Block
+	if hash != "" {
+		blockHash, err := hex.DecodeString(hash)
+		if err != nil {
+			log.Panic("ERROR: Block hash is not valid")
+		}
+		block, err = bc.GetBlock(blockHash)
+	} else {
+		block, err = bc.GetBlockByHeight(height)
+	}
+	if err != nil {
+		log.Panic(err)
+	}
+
+	printBlock(block)
+}
+
+func (cli *CLI) getBlockCount(nodeID string) {
+	bc, err := NewBlockchain(nodeID)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer bc.Close()
+
+	fmt.Println(bc.GetBestHeight())
+}
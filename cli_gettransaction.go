@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log"
+)
+
+func (cli *CLI) getTransaction(id, nodeID string) {
+	txID, err := hex.DecodeString(id)
+	if err != nil {
+		log.Panic("ERROR: Transaction ID is not valid")
+	}
+	bc, err := NewBlockchain(nodeID)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer bc.Close()
+
+	tx, block, err := bc.FindTransactionBlock(txID)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	fmt.Printf("Block: %x\n", block.Hash)
+	fmt.Printf("Height: %d\n", block.Height)
+	fmt.Printf("Confirmations: %d\n\n", bc.GetBestHeight()-block.Height+1)
+	fmt.Println(tx.String())
+}
+
+func (cli *CLI) reindexTransactions(nodeID string) {
+	bc, err := NewBlockchain(nodeID)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer bc.Close()
+
+	fmt.Println("Building the transaction index from blocks...")
+	err = bc.ReindexTransactions()
+	if err != nil {
+		log.Panic(err)
+	}
+	fmt.Println("Done! The transaction index is kept up to date from now on.")
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+)
+
+// createHTLC locks amount from address from with a contract redeemable by address to with the secret of
+// hexHash, or refundable after timeout blocks. Without hexHash a secret is drawn and printed
+func (cli *CLI) createHTLC(from, to string, amount int, hexHash string, timeout, fee int, node, nodeID string) {
+	if !ValidateAddress(from) || !ValidateAddress(to) {
+		log.Panic("ERROR: Address is not valid")
+	}
+	if addressVersion, _ := decodeAddress(to); addressVersion != version {
+		log.Panicf("ERROR: %s is not the address of a key, it can't redeem a contract", to)
+	}
+
+	var secret []byte
+	var hash []byte
+	if hexHash == "" {
+		secret = make([]byte, htlcSecretLen)
+		_, err := rand.Read(secret)
+		if err != nil {
+			log.Panic(err)
+		}
+		secretHash := sha256.Sum256(secret)
+		hash = secretHash[:]
+	} else {
+		var err error
+		hash, err = hex.DecodeString(hexHash)
+		if err != nil || len(hash) != sha256.Size {
+			log.Panic("ERROR: Hash is not a hex encoded SHA-256 hash")
+		}
+	}
+
+	bc, err := NewBlockchain(nodeID)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer bc.Close()
+
+	wallets, err := NewWallets()
+	if err != nil {
+		log.Panic(err)
+	}
+	unlockWallets(wallets)
+	wallet, err := wallets.GetWallet(from)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	_, recipient := decodeAddress(to)
+	h := &HTLC{hash, recipient, HashPubKey(wallet.PublicKey), bc.GetBestHeight() + timeout}
+	tx, err := NewHTLCTransaction(wallet, h, amount, fee, nil, &UTXOSet{bc})
+	if err != nil {
+		log.Panic(err)
+	}
+	submitTransaction(bc, tx, from, node)
+
+	fmt.Printf("Contract: -txid %x -vout 0\n", tx.ID)
+	fmt.Printf("Hash: %x\n", h.Hash)
+	fmt.Printf("Refundable from height: %d\n", h.Timeout)
+	if secret != nil {
+		fmt.Printf("Secret: %x\n", secret)
+		fmt.Println("Keep the secret until the other side of the swap is locked with this hash, then redeem it")
+	}
+}
+
+// redeemHTLC spends the contract output vout of transaction txID with the secret, to the wallet of its recipient
+func (cli *CLI) redeemHTLC(txID string, vout int, hexSecret string, fee int, node, nodeID string) {
+	secret, err := hex.DecodeString(hexSecret)
+	if err != nil {
+		log.Panic("ERROR: Secret is not hex encoded")
+	}
+
+	bc, prevTx, h := findHTLC(txID, vout, nodeID)
+	defer bc.Close()
+
+	address := string(PubKeyHashToAddress(h.Recipient))
+	wallet := getHTLCWallet(address)
+	tx, err := NewHTLCRedeemTransaction(wallet, prevTx, vout, secret, fee, bc.GenesisHash())
+	if err != nil {
+		log.Panic(err)
+	}
+	submitTransaction(bc, tx, address, node)
+
+	fmt.Printf("Redeemed to %s by transaction %x, which reveals the secret\n", address, tx.ID)
+}
+
+// refundHTLC gives the contract output vout of transaction txID back to its sender, once it timed out
+func (cli *CLI) refundHTLC(txID string, vout, fee int, node, nodeID string) {
+	bc, prevTx, h := findHTLC(txID, vout, nodeID)
+	defer bc.Close()
+
+	if next := bc.GetBestHeight() + 1; next < h.Timeout {
+		log.Panicf("ERROR: The contract can be refunded from height %d, the next block has height %d", h.Timeout, next)
+	}
+
+	address := string(PubKeyHashToAddress(h.Sender))
+	wallet := getHTLCWallet(address)
+	tx, err := NewHTLCRefundTransaction(wallet, prevTx, vout, fee, bc.GenesisHash())
+	if err != nil {
+		log.Panic(err)
+	}
+	submitTransaction(bc, tx, address, node)
+
+	fmt.Printf("Refunded to %s by transaction %x\n", address, tx.ID)
+}
+
+// htlcSecret prints the secret revealed by the transaction redeeming the contract output vout of transaction txID
+// The sender of a contract learns there the secret redeeming the other side of a swap
+func (cli *CLI) htlcSecret(txID string, vout int, nodeID string) {
+	bc, prevTx, _ := findHTLC(txID, vout, nodeID)
+	defer bc.Close()
+
+	spending, err := bc.FindSpendingTransaction(prevTx.ID, vout)
+	if err != nil {
+		log.Panic("ERROR: The contract isn't spent yet")
+	}
+	for _, vin := range spending.Vin {
+		if !bytes.Equal(vin.Txid, prevTx.ID) || vin.Vout != vout {
+			continue
+		}
+		secret, ok := vin.HTLCSecret()
+		if !ok {
+			log.Panicf("ERROR: The contract was refunded by transaction %x", spending.ID)
+		}
+		fmt.Printf("%x\n", secret)
+	}
+}
+
+// findHTLC opens the blockchain of nodeID and returns the transaction txID along with the contract of its output vout
+func findHTLC(txID string, vout int, nodeID string) (*Blockchain, *Transaction, *HTLC) {
+	id, err := hex.DecodeString(txID)
+	if err != nil {
+		log.Panic("ERROR: Transaction ID is not valid")
+	}
+
+	bc, err := NewBlockchain(nodeID)
+	if err != nil {
+		log.Panic(err)
+	}
+	prevTx, err := bc.FindTransaction(id)
+	if err != nil {
+		bc.Close()
+		log.Panic(err)
+	}
+	h, err := outputHTLC(&prevTx, vout)
+	if err != nil {
+		bc.Close()
+		log.Panic(err)
+	}
+	return bc, &prevTx, h
+}
+
+// getHTLCWallet returns the unlocked wallet of address, a party of a contract
+func getHTLCWallet(address string) *Wallet {
+	wallets, err := NewWallets()
+	if err != nil {
+		log.Panic(err)
+	}
+	unlockWallets(wallets)
+	wallet, err := wallets.GetWallet(address)
+	if err != nil {
+		log.Panic(err)
+	}
+	return wallet
+}
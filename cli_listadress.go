@@ -5,7 +5,8 @@ import (
 	"log"
 )
 
-func (cli *CLI) listAddresses() {
+// listAddresses prints the addresses of the wallet file, with their hex encoded public keys if pubKeys is set
+func (cli *CLI) listAddresses(pubKeys bool) {
 	wallets, err := NewWallets()
 	if err != nil {
 		log.Panic(err)
@@ -13,6 +14,25 @@ func (cli *CLI) listAddresses() {
 	addresses := wallets.GetAddresses()
 
 	for _, address := range addresses {
-		fmt.Println(address)
+		if !pubKeys {
+			fmt.Println(address)
+			continue
+		}
+		pubKey, err := wallets.GetPublicKey(address)
+		if err != nil {
+			log.Panic(err)
+		}
+		fmt.Printf("%s %x\n", address, pubKey)
+	}
+	for _, address := range wallets.GetWatchOnlyAddresses() {
+		if pubKey, err := wallets.GetPublicKey(address); pubKeys && err == nil {
+			fmt.Printf("%s (watch-only) %x\n", address, pubKey)
+			continue
+		}
+		fmt.Printf("%s (watch-only)\n", address)
+	}
+	for _, address := range wallets.GetMultisigAddresses() {
+		policy, _ := wallets.GetMultisig(address)
+		fmt.Printf("%s (multisig %d of %d)\n", address, policy.Required, len(policy.PubKeys))
 	}
 }
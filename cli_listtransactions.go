@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// listTransactions prints the history of an address, count transactions at most after skipping the skip most recent ones
+// The address is checked by the command, decoding an invalid one would fail
+func (cli *CLI) listTransactions(address string, count, skip int, nodeID string) {
+	bc, err := NewBlockchain(nodeID)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer bc.Close()
+
+	_, pubKeyHash := decodeAddress(address)
+	history, err := bc.AddressHistory(pubKeyHash)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	page, start := HistoryPage(history, count, skip)
+	fmt.Printf("Transactions of '%s': %d to %d of %d\n", address, start+1, start+len(page), len(history))
+	fmt.Printf("%-8s %-64s %10s %10s %10s  %s\n", "Height", "Transaction", "Received", "Sent", "Balance", "Counterparties")
+	for _, entry := range page {
+		var counterparties []string
+		if entry.Coinbase {
+			counterparties = append(counterparties, "coinbase")
+		}
+		for _, address := range entry.Counterparties {
+			counterparties = append(counterparties, string(address))
+		}
+
+		fmt.Printf("%-8d %x %10d %10d %10d  %s\n", entry.Height, entry.TxID, entry.Received, entry.Sent, entry.Balance, strings.Join(counterparties, ", "))
+	}
+}
+
+func (cli *CLI) reindexAddresses(nodeID string) {
+	bc, err := NewBlockchain(nodeID)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer bc.Close()
+
+	fmt.Println("Building the address index from blocks...")
+	err = bc.ReindexAddresses()
+	if err != nil {
+		log.Panic(err)
+	}
+	fmt.Println("Done! The address index is kept up to date from now on.")
+}
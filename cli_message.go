@@ -0,0 +1,34 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log"
+)
+
+func (cli *CLI) signMessage(address, message string) {
+	wallets, err := NewWallets()
+	if err != nil {
+		log.Panic(err)
+	}
+	unlockWallets(wallets)
+
+	wallet, err := wallets.GetWallet(address)
+	if err != nil {
+		log.Panic(err)
+	}
+	fmt.Printf("%x\n", SignMessage(wallet, []byte(message)))
+}
+
+func (cli *CLI) verifyMessage(address, signature, message string) {
+	sig, err := hex.DecodeString(signature)
+	if err != nil {
+		log.Panic("ERROR: Signature is not hex encoded")
+	}
+
+	err = VerifyMessage(address, sig, []byte(message))
+	if err != nil {
+		log.Panic(err)
+	}
+	fmt.Printf("The message is signed by the key of '%s'\n", address)
+}
@@ -2,23 +2,22 @@ package main
 
 import (
 	"fmt"
+	"log"
 	"strconv"
 )
 
-func (cli *CLI) printChain() {
-	cli.bc = NewBlockchain("")
-	defer cli.bc.db.Close()
+func (cli *CLI) printChain(nodeID string) {
+	bc, err := NewBlockchain(nodeID)
+	if err != nil {
+		log.Panic(err)
+	}
+	cli.bc = bc
+	defer cli.bc.Close()
 	bci := cli.bc.Iterator()
 	for {
 		block := bci.Next()
 
-		fmt.Printf("============ Block %x ============\n", block.Hash)
-		fmt.Printf("Prev. block: %x\n", block.PrevBlockHash)
-		pow := NewProofOfWork(block)
-		fmt.Printf("PoW: %s\n\n", strconv.FormatBool(pow.Validate()))
-		for _, tx := range block.Transactions {
-			fmt.Println(tx)
-		}
+		printBlock(block)
 		fmt.Printf("\n\n")
 
 		if len(block.PrevBlockHash) == 0 {
@@ -26,3 +25,16 @@ func (cli *CLI) printChain() {
 		}
 	}
 }
+
+// printBlock prints the header of a block followed by its transactions
+func printBlock(block *Block) {
+	fmt.Printf("============ Block %x ============\n", block.Hash)
+	fmt.Printf("Height: %d\n", block.Height)
+	fmt.Printf("Prev. block: %x\n", block.PrevBlockHash)
+	fmt.Printf("Target: %x\n", block.Target)
+	pow := NewProofOfWork(block)
+	fmt.Printf("PoW: %s\n\n", strconv.FormatBool(pow.Validate()))
+	for _, tx := range block.Transactions {
+		fmt.Println(tx.String())
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+)
+
+func (cli *CLI) dumpPrivKey(address string) {
+	wallets, err := NewWallets()
+	if err != nil {
+		log.Panic(err)
+	}
+	unlockWallets(wallets)
+
+	wallet, err := wallets.GetWallet(address)
+	if err != nil {
+		log.Panic(err)
+	}
+	fmt.Printf("%s\n", EncodePrivateKey(wallet))
+}
+
+// importPrivKey adds an exported private key to the wallet file
+// With rescan, the chain is searched for the transactions of its address, to show its balance right away
+func (cli *CLI) importPrivKey(key string, rescan bool, nodeID string) {
+	wallet, err := DecodePrivateKey(key)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	wallets, err := NewWallets()
+	if err != nil && !os.IsNotExist(err) {
+		log.Panic(err)
+	}
+	unlockWallets(wallets)
+
+	address, err := wallets.ImportWallet(wallet)
+	if err != nil {
+		log.Panic(err)
+	}
+	err = wallets.SaveToFile()
+	if err != nil {
+		log.Panic(err)
+	}
+	fmt.Printf("Imported address: %s\n", address)
+
+	if !rescan {
+		return
+	}
+	bc, err := NewBlockchain(nodeID)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer bc.Close()
+
+	history, err := bc.AddressHistory(HashPubKey(wallet.PublicKey))
+	if err != nil {
+		log.Panic(err)
+	}
+	balance := 0
+	if len(history) > 0 {
+		balance = history[len(history)-1].Balance
+	}
+	fmt.Printf("Found %d transactions, balance of '%s': %d\n", len(history), address, balance)
+}
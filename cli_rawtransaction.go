@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+)
+
+// createRawTransaction writes an unsigned transaction paying payments from address from to file
+// The node only needs the address, the keys stay on the machines running signrawtransaction. The policy of a
+// multisig address is read from the wallet file
+func (cli *CLI) createRawTransaction(from string, payments []Payment, fee int, coinSelect, file, nodeID string) {
+	newSelector, ok := coinSelectors[coinSelect]
+	if !ok {
+		log.Panicf("ERROR: Unknown coin selection strategy %q", coinSelect)
+	}
+
+	bc, err := NewBlockchain(nodeID)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer bc.Close()
+
+	UTXOSet := UTXOSet{bc}
+	var raw *RawTransaction
+	if addressVersion, _ := decodeAddress(from); ValidateAddress(from) && addressVersion == multisigVersion {
+		// the inputs of a multisig address reveal its policy, which the wallet file keeps
+		wallets, err := NewWallets()
+		if err != nil {
+			log.Panic(err)
+		}
+		policy, err := wallets.GetMultisig(from)
+		if err != nil {
+			log.Panic(err)
+		}
+		raw, err = NewMultisigRawTransaction(policy, payments, fee, newSelector(), &UTXOSet)
+		if err != nil {
+			log.Panic(err)
+		}
+	} else {
+		raw, err = NewRawTransaction(from, payments, fee, newSelector(), &UTXOSet)
+		if err != nil {
+			log.Panic(err)
+		}
+	}
+	err = raw.SaveToFile(file)
+	if err != nil {
+		log.Panic(err)
+	}
+	fmt.Printf("Unsigned transaction with %d inputs written to %s\n", len(raw.Tx.Vin), file)
+}
+
+// signRawTransaction signs the inputs of the transaction in file that the wallet file has the keys of
+// and writes it to out. It doesn't need the blockchain, so it can run on a machine that is never online
+func (cli *CLI) signRawTransaction(file, out string) {
+	raw, err := LoadRawTransaction(file)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	// shown before the passphrase is asked for, the previous outputs in the file give the fee
+	fee, err := raw.Fee()
+	if err != nil {
+		log.Panic(err)
+	}
+	fmt.Println("Outputs:")
+	for _, vout := range raw.Tx.Vout {
+		if vout.Script != nil {
+			fmt.Printf("  script %x %d\n", vout.Script, vout.Value)
+			continue
+		}
+		fmt.Printf("  %s %d\n", vout.Address(), vout.Value)
+	}
+	fmt.Printf("Fee: %d\n", fee)
+	fmt.Printf("Chain: %x\n", raw.Genesis)
+
+	wallets, err := NewWallets()
+	if err != nil {
+		log.Panic(err)
+	}
+	unlockWallets(wallets)
+
+	signed := 0
+	for _, address := range wallets.GetAddresses() {
+		wallet, err := wallets.GetWallet(address)
+		if err != nil {
+			log.Panic(err)
+		}
+		n, err := raw.Sign(wallet)
+		if err != nil {
+			log.Panic(err)
+		}
+		signed += n
+	}
+
+	err = raw.SaveToFile(out)
+	if err != nil {
+		log.Panic(err)
+	}
+	fmt.Printf("Added %d signatures, written to %s\n", signed, out)
+	if !raw.IsComplete() {
+		fmt.Println("Some inputs still need the signature of another wallet")
+	}
+}
+
+// sendRawTransaction checks the signed transaction in file, then submits it to node or mines it locally with
+// the reward paid to miner. The addresses of the previous outputs come with the file, so they don't get the reward
+func (cli *CLI) sendRawTransaction(file, node, miner, nodeID string) {
+	if node == "" && !ValidateAddress(miner) {
+		log.Panic("ERROR: Miner address is not valid")
+	}
+	raw, err := LoadRawTransaction(file)
+	if err != nil {
+		log.Panic(err)
+	}
+	err = raw.Verify()
+	if err != nil {
+		log.Panic(err)
+	}
+
+	bc, err := NewBlockchain(nodeID)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer bc.Close()
+
+	if !bytes.Equal(raw.Genesis, bc.GenesisHash()) {
+		log.Panicf("ERROR: The transaction is signed for the chain %x, not this one", raw.Genesis)
+	}
+	submitTransaction(bc, &raw.Tx, miner, node)
+	fmt.Printf("Success! Transaction %x\n", raw.Tx.ID)
+}
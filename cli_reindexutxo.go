@@ -1 +1,25 @@
 package main
+
+import (
+	"fmt"
+	"log"
+)
+
+func (cli *CLI) reindexUTXO(nodeID string) {
+	bc, err := NewBlockchain(nodeID)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer bc.Close()
+
+	fmt.Println("Rebuilding the UTXO set from blocks...")
+	UTXOSet := UTXOSet{bc}
+	UTXOSet.ReindexWithProgress(func(blocks int) {
+		fmt.Printf("\rScanned %d blocks", blocks)
+	})
+	fmt.Printf("\n")
+
+	stats := UTXOSet.Stats()
+	fmt.Printf("Done! There are %d transactions with %d unspent outputs in the UTXO set.\n", stats.Transactions, stats.Outputs)
+	fmt.Printf("Total supply: %d\n", stats.Supply)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+)
+
+// restoreWallet gives the wallet file the seed of mnemonic, and adds back the addresses the chain shows were used
+func (cli *CLI) restoreWallet(mnemonic, nodeID string) {
+	wallets, err := NewWallets()
+	if err != nil && !os.IsNotExist(err) {
+		log.Panic(err)
+	}
+	unlockWallets(wallets)
+
+	bc, err := NewBlockchain(nodeID)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer bc.Close()
+
+	used, err := bc.UsedPubKeyHashes()
+	if err != nil {
+		log.Panic(err)
+	}
+	addresses, err := wallets.RestoreSeed(mnemonic, func(pubKeyHash []byte) bool {
+		return used[hex.EncodeToString(pubKeyHash)]
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+	err = wallets.SaveToFile()
+	if err != nil {
+		log.Panic(err)
+	}
+
+	for _, address := range addresses {
+		fmt.Println(address)
+	}
+	fmt.Printf("Restored %d addresses, new addresses are derived from the seed from now on\n", len(addresses))
+}
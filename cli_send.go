@@ -1,22 +1,177 @@
 package main
 
 import (
+	"encoding/csv"
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 )
 
-func (cli *CLI) send(from, to string, amount int) {
+// send pays payments from the wallet of address from, with the outputs picked by the coinSelect strategy
+// In dry run, the transaction is shown instead of being submitted or mined
+func (cli *CLI) send(from string, payments []Payment, fee, feeRate, lockTime int, coinSelect string, dryRun bool, node, nodeID string) {
 	if !ValidateAddress(from) {
 		log.Panic("ERROR: Sender address is not valid")
 	}
-	if !ValidateAddress(to) {
-		log.Panic("ERROR: Recipient address is not valid")
+	err := checkPayments(payments)
+	if err != nil {
+		log.Panic(err)
+	}
+	newSelector, ok := coinSelectors[coinSelect]
+	if !ok {
+		log.Panicf("ERROR: Unknown coin selection strategy %q", coinSelect)
+	}
+
+	bc, err := NewBlockchain(nodeID)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer bc.Close()
+
+	wallets, err := NewWallets()
+	if err != nil {
+		log.Panic(err)
+	}
+	if wallets.IsWatchOnly(from) {
+		log.Panicf("ERROR: %s is watch-only, the wallet has no private key to spend from it", from)
+	}
+	if _, err := wallets.GetMultisig(from); err == nil {
+		log.Panicf("ERROR: %s is a multisig address, spend from it with createrawtransaction and signrawtransaction", from)
+	}
+	unlockWallets(wallets)
+	wallet, err := wallets.GetWallet(from)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	UTXOSet := UTXOSet{bc}
+	var tx *Transaction
+	if feeRate > 0 {
+		tx, err = NewPaymentTransactionWithFeeRate(wallet, payments, feeRate, lockTime, newSelector(), &UTXOSet)
+	} else {
+		tx, err = NewPaymentTransaction(wallet, payments, fee, lockTime, newSelector(), &UTXOSet)
+	}
+	if err != nil {
+		log.Panic(err)
 	}
 
-	bc := NewBlockchain(from)
-	defer bc.db.Close()
+	if dryRun {
+		printDryRun(bc, tx, HashPubKey(wallet.PublicKey))
+		return
+	}
 
-	tx := NewUTXOTransaction(from, to, amount, bc)
-	bc.MineBlock([]*Transaction{tx})
+	submitTransaction(bc, tx, from, node)
 	fmt.Println("Success!")
 }
+
+// submitTransaction sends tx to the node at address node, or mines it locally with the reward paid to miner
+func submitTransaction(bc *Blockchain, tx *Transaction, miner, node string) {
+	if node != "" {
+		err := SendTransaction(node, tx)
+		if err != nil {
+			log.Panic(err)
+		}
+		return
+	}
+
+	mempool := NewMempool(bc)
+	err := mempool.Add(tx)
+	if err != nil {
+		log.Panic(err)
+	}
+	// a node keeps a locked transaction until it can be mined, mining locally can't wait
+	err = bc.CheckLockTimes(tx)
+	if err != nil {
+		log.Panicf("ERROR: %v, submit it to a node with -node to have it mined once it unlocks", err)
+	}
+
+	txs := mempool.Select(defaultMaxBlockTxs)
+	cbTx := NewRewardTX(miner, "", subsidy+bc.TotalFees(txs))
+	bc.MineBlock(append([]*Transaction{cbTx}, txs...))
+}
+
+// printDryRun shows the inputs a transaction spends, what it pays, its change, fee and size
+func printDryRun(bc *Blockchain, tx *Transaction, changePubKeyHash []byte) {
+	fmt.Println("Inputs:")
+	for _, vin := range tx.Vin {
+		prevTx, err := bc.FindTransaction(vin.Txid)
+		if err != nil {
+			log.Panic(err)
+		}
+		fmt.Printf("  %x:%d %d\n", vin.Txid, vin.Vout, prevTx.Vout[vin.Vout].Value)
+	}
+
+	change := 0
+	fmt.Println("Outputs:")
+	for _, out := range tx.Vout {
+		if out.IsLockedWithKey(changePubKeyHash) {
+			change += out.Value
+			continue
+		}
+		fmt.Printf("  %s %d\n", out.Address(), out.Value)
+	}
+
+	fee, err := bc.TransactionFee(tx)
+	if err != nil {
+		log.Panic(err)
+	}
+	fmt.Printf("Change: %d\n", change)
+	fmt.Printf("Fee: %d\n", fee)
+	fmt.Printf("Size: %d bytes\n", len(tx.Serialize()))
+	if tx.LockTime >= lockTimeThreshold {
+		fmt.Printf("Locked until: %s\n", time.Unix(int64(tx.LockTime), 0).UTC().Format(time.RFC3339))
+	} else if tx.LockTime > 0 {
+		fmt.Printf("Locked until height: %d\n", tx.LockTime)
+	}
+	fmt.Printf("ID: %x\n", tx.ID)
+}
+
+// readPayments reads the payments of a batch file
+// A .json file holds an array of {"address": ADDRESS, "amount": AMOUNT} objects, any other file is read as CSV
+// with one ADDRESS,AMOUNT line per payment and an optional header line
+func readPayments(file string) ([]Payment, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var payments []Payment
+	if strings.EqualFold(filepath.Ext(file), ".json") {
+		err = json.NewDecoder(f).Decode(&payments)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+		return payments, nil
+	}
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = 2
+	r.TrimLeadingSpace = true
+	for line := 1; ; line++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+
+		amount, err := strconv.Atoi(record[1])
+		if err != nil {
+			if line == 1 {
+				continue
+			}
+			return nil, fmt.Errorf("%s:%d: amount %q is not a number", file, line, record[1])
+		}
+		payments = append(payments, Payment{record[0], amount})
+	}
+
+	return payments, nil
+}
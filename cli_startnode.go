@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+)
+
+const defaultSeed = "localhost:3000"
+
+func (cli *CLI) startNode(nodeID, minerAddress, seeds string, maxBlockTxs int) {
+	if minerAddress != "" {
+		if !ValidateAddress(minerAddress) {
+			log.Panic("ERROR: Miner address is not valid")
+		}
+		fmt.Println("Mining is on. Address to receive rewards: ", minerAddress)
+	}
+
+	bc, err := NewBlockchain(nodeID)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer bc.Close()
+
+	var seedList []string
+	for _, seed := range strings.Split(seeds, ",") {
+		if seed != "" {
+			seedList = append(seedList, seed)
+		}
+	}
+
+	server := NewServer(fmt.Sprintf("localhost:%s", nodeID), minerAddress, bc, seedList)
+	server.MaxBlockTxs = maxBlockTxs
+	err = server.Start()
+	if err != nil {
+		log.Panic(err)
+	}
+	fmt.Printf("Starting node %s\n", server.Addr())
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	<-interrupt
+
+	server.Stop()
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+)
+
+func (cli *CLI) validateChain(fast bool, nodeID string) {
+	bc, err := NewBlockchain(nodeID)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	checked, err := bc.Validate(fast)
+	bc.Close()
+	if err != nil {
+		fmt.Println(err)
+		fmt.Printf("%d blocks before it are valid\n", checked)
+		os.Exit(1)
+	}
+
+	fmt.Printf("The chain is valid, %d blocks checked\n", checked)
+}
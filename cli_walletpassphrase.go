@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// passphraseEnv and newPassphraseEnv let scripts pass passphrases without a prompt
+const passphraseEnv = "WALLET_PASSPHRASE"
+const newPassphraseEnv = "WALLET_NEW_PASSPHRASE"
+
+var stdin = bufio.NewReader(os.Stdin)
+
+// readPassphrase returns the passphrase from the environment variable env, or asks for it on the terminal
+func readPassphrase(env, prompt string) string {
+	if passphrase, ok := os.LookupEnv(env); ok {
+		return passphrase
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	line, err := stdin.ReadString('\n')
+	if err != nil && line == "" {
+		log.Panic("ERROR: No passphrase given")
+	}
+	return strings.TrimRight(line, "\r\n")
+}
+
+// readNewPassphrase asks for a new passphrase twice, unless it comes from the environment variable env
+func readNewPassphrase(env string) string {
+	if passphrase, ok := os.LookupEnv(env); ok {
+		return passphrase
+	}
+
+	passphrase := readPassphrase(env, "New passphrase: ")
+	if passphrase == "" {
+		log.Panic("ERROR: The passphrase can't be empty")
+	}
+	if readPassphrase(env, "Repeat the new passphrase: ") != passphrase {
+		log.Panic("ERROR: The passphrases don't match")
+	}
+	return passphrase
+}
+
+// unlockWallets asks for the passphrase of encrypted wallets and decrypts their keys
+func unlockWallets(wallets *Wallets) {
+	if !wallets.IsEncrypted() {
+		return
+	}
+	err := wallets.Unlock(readPassphrase(passphraseEnv, "Wallet passphrase: "))
+	if err != nil {
+		log.Panic(err)
+	}
+}
+
+func (cli *CLI) encryptWallet() {
+	wallets, err := NewWallets()
+	if err != nil {
+		log.Panic(err)
+	}
+
+	err = wallets.Encrypt(readNewPassphrase(passphraseEnv))
+	if err != nil {
+		log.Panic(err)
+	}
+	err = wallets.SaveToFile()
+	if err != nil {
+		log.Panic(err)
+	}
+	fmt.Println("The wallet is encrypted, its passphrase is needed to send coins from now on")
+}
+
+func (cli *CLI) changePassphrase() {
+	wallets, err := NewWallets()
+	if err != nil {
+		log.Panic(err)
+	}
+
+	oldPassphrase := readPassphrase(passphraseEnv, "Current passphrase: ")
+	err = wallets.ChangePassphrase(oldPassphrase, readNewPassphrase(newPassphraseEnv))
+	if err != nil {
+		log.Panic(err)
+	}
+	err = wallets.SaveToFile()
+	if err != nil {
+		log.Panic(err)
+	}
+	fmt.Println("The passphrase is changed")
+}
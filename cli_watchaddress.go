@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+)
+
+// watchAddress adds a watch-only address to the wallet file, given as an address or as a hex encoded public key
+func (cli *CLI) watchAddress(address, pubKey string) {
+	wallets, err := NewWallets()
+	if err != nil && !os.IsNotExist(err) {
+		log.Panic(err)
+	}
+
+	if pubKey != "" {
+		key, err := hex.DecodeString(pubKey)
+		if err != nil {
+			log.Panic("ERROR: Public key is not hex encoded")
+		}
+		address, err = wallets.WatchPublicKey(key)
+		if err != nil {
+			log.Panic(err)
+		}
+	} else {
+		err = wallets.WatchAddress(address)
+		if err != nil {
+			log.Panic(err)
+		}
+	}
+
+	err = wallets.SaveToFile()
+	if err != nil {
+		log.Panic(err)
+	}
+	fmt.Printf("Watching address: %s\n", address)
+}
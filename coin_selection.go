@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// SpendableOutput is an unspent output a wallet can use as an input
+type SpendableOutput struct {
+	TxID  []byte
+	Vout  int
+	Value int
+}
+
+// CoinSelector picks the outputs a transaction spends to pay amount, the payments and the fee
+// It returns ErrNotEnoughFunds when the outputs can't cover amount
+type CoinSelector interface {
+	Select(outputs []SpendableOutput, amount int) ([]SpendableOutput, error)
+}
+
+// coinSelectors are the strategies that can be chosen by name with send -coinselect
+var coinSelectors = map[string]func() CoinSelector{
+	"largest":  func() CoinSelector { return LargestFirst{} },
+	"smallest": func() CoinSelector { return SmallestFirst{} },
+	"bnb":      func() CoinSelector { return BranchAndBound{MaxTries: defaultBnBTries} },
+	"random":   func() CoinSelector { return RandomSelector{rand.New(rand.NewSource(time.Now().UnixNano()))} },
+}
+
+const defaultCoinSelector = "largest"
+const defaultBnBTries = 100000
+
+// LargestFirst spends the biggest outputs first, using as few inputs as possible
+type LargestFirst struct{}
+
+// Select implements CoinSelector
+func (LargestFirst) Select(outputs []SpendableOutput, amount int) ([]SpendableOutput, error) {
+	sorted := sortedOutputs(outputs, func(a, b SpendableOutput) bool { return a.Value > b.Value })
+	return accumulate(sorted, amount)
+}
+
+// SmallestFirst spends the smallest outputs first, consolidating dust at the cost of bigger transactions
+type SmallestFirst struct{}
+
+// Select implements CoinSelector
+func (SmallestFirst) Select(outputs []SpendableOutput, amount int) ([]SpendableOutput, error) {
+	sorted := sortedOutputs(outputs, func(a, b SpendableOutput) bool { return a.Value < b.Value })
+	return accumulate(sorted, amount)
+}
+
+// BranchAndBound looks for a set of outputs adding up to amount, so the transaction needs no change output
+// Up to MaxWaste more than amount is accepted, the excess still comes back as change. The search gives up
+// after MaxTries steps, and falls back to LargestFirst when there is no such set
+type BranchAndBound struct {
+	MaxTries int
+	MaxWaste int
+}
+
+// Select implements CoinSelector
+func (s BranchAndBound) Select(outputs []SpendableOutput, amount int) ([]SpendableOutput, error) {
+	sorted := sortedOutputs(outputs, func(a, b SpendableOutput) bool { return a.Value > b.Value })
+
+	// remaining[i] is the value of the outputs from i on, to prune branches that can't reach amount
+	remaining := make([]int, len(sorted)+1)
+	for i := len(sorted) - 1; i >= 0; i-- {
+		remaining[i] = remaining[i+1] + sorted[i].Value
+	}
+
+	tries := 0
+	var selected []SpendableOutput
+	var search func(i, total int) bool
+	search = func(i, total int) bool {
+		tries++
+		if total >= amount {
+			return total <= amount+s.MaxWaste
+		}
+		if i == len(sorted) || total+remaining[i] < amount || tries > s.MaxTries {
+			return false
+		}
+
+		// with the output, then without it
+		selected = append(selected, sorted[i])
+		if search(i+1, total+sorted[i].Value) {
+			return true
+		}
+		selected = selected[:len(selected)-1]
+		return search(i+1, total)
+	}
+
+	if search(0, 0) {
+		return selected, nil
+	}
+	return LargestFirst{}.Select(outputs, amount)
+}
+
+// RandomSelector spends outputs in random order, so that transactions reveal less about the wallet
+type RandomSelector struct {
+	Rand *rand.Rand
+}
+
+// Select implements CoinSelector
+func (s RandomSelector) Select(outputs []SpendableOutput, amount int) ([]SpendableOutput, error) {
+	shuffled := append([]SpendableOutput{}, outputs...)
+	s.Rand.Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+	return accumulate(shuffled, amount)
+}
+
+// sortedOutputs returns a sorted copy of outputs, the order of outputs of equal value is kept
+func sortedOutputs(outputs []SpendableOutput, less func(a, b SpendableOutput) bool) []SpendableOutput {
+	sorted := append([]SpendableOutput{}, outputs...)
+	sort.SliceStable(sorted, func(i, j int) bool { return less(sorted[i], sorted[j]) })
+	return sorted
+}
+
+// accumulate takes outputs in order until they cover amount
+func accumulate(outputs []SpendableOutput, amount int) ([]SpendableOutput, error) {
+	var selected []SpendableOutput
+	total := 0
+
+	for _, out := range outputs {
+		if total >= amount {
+			break
+		}
+		selected = append(selected, out)
+		total += out.Value
+	}
+
+	if total < amount {
+		return nil, fmt.Errorf("%w: %d needed, %d available", ErrNotEnoughFunds, amount, total)
+	}
+	return selected, nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+func values(outputs []SpendableOutput) []int {
+	var v []int
+	for _, out := range outputs {
+		v = append(v, out.Value)
+	}
+	return v
+}
+
+func TestCoinSelectors(t *testing.T) {
+	var outputs []SpendableOutput
+	for i, value := range []int{5, 1, 8, 3, 2} {
+		outputs = append(outputs, SpendableOutput{[]byte{byte(i)}, 0, value})
+	}
+
+	tests := []struct {
+		name     string
+		selector CoinSelector
+		amount   int
+		want     []int
+	}{
+		{"largest", LargestFirst{}, 9, []int{8, 5}},
+		{"smallest", SmallestFirst{}, 4, []int{1, 2, 3}},
+		{"bnb exact", BranchAndBound{MaxTries: defaultBnBTries}, 10, []int{8, 2}},
+		{"not enough", BranchAndBound{MaxTries: defaultBnBTries}, 20, nil},
+	}
+	for _, test := range tests {
+		selected, err := test.selector.Select(outputs, test.amount)
+		if test.want == nil {
+			if !errors.Is(err, ErrNotEnoughFunds) {
+				t.Errorf("%s: got %v, want %v", test.name, err, ErrNotEnoughFunds)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got := values(selected); len(got) != len(test.want) {
+			t.Errorf("%s: selected %v, want %v", test.name, got, test.want)
+		} else {
+			for i := range got {
+				if got[i] != test.want[i] {
+					t.Errorf("%s: selected %v, want %v", test.name, got, test.want)
+					break
+				}
+			}
+		}
+	}
+
+	// without an exact match branch and bound spends like largest first, unless some waste is accepted
+	uneven := []SpendableOutput{{nil, 0, 4}, {nil, 1, 3}, {nil, 2, 3}}
+	selected, err := BranchAndBound{MaxTries: defaultBnBTries}.Select(uneven, 5)
+	if err != nil || len(selected) != 2 || selected[0].Value != 4 {
+		t.Errorf("bnb without an exact match selected %v, %v", values(selected), err)
+	}
+	selected, err = BranchAndBound{MaxTries: defaultBnBTries, MaxWaste: 1}.Select(uneven, 5)
+	if err != nil || len(selected) != 2 || selected[0].Value != 3 || selected[1].Value != 3 {
+		t.Errorf("bnb with a waste of 1 selected %v, %v", values(selected), err)
+	}
+
+	selected, err = RandomSelector{rand.New(rand.NewSource(1))}.Select(outputs, 12)
+	total := 0
+	for _, out := range selected {
+		total += out.Value
+	}
+	if err != nil || total < 12 {
+		t.Errorf("random selected %v, %v", values(selected), err)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"math/big"
+)
+
+// hardenedKeyStart is the first index of hardened children, derived from the private key only
+const hardenedKeyStart = uint32(1) << 31
+
+// hdMasterKeySalt is the HMAC key turning a seed into a master key, as SLIP-0010 does for NIST P-256
+var hdMasterKeySalt = []byte("Nist256p1 seed")
+
+// hdAddressPath is where the addresses of a wallet are derived from its seed: the external chain of the
+// first account in the default wallet layout of BIP32, m/0'/0/i
+var hdAddressPath = []uint32{hardenedKeyStart + 0, 0}
+
+// ExtendedKey is a BIP32 private key on P-256 along with the chain code deriving its children
+type ExtendedKey struct {
+	Key       *big.Int
+	ChainCode []byte
+}
+
+// NewMasterKey derives the root key of an HD wallet from its seed
+func NewMasterKey(seed []byte) *ExtendedKey {
+	data := seed
+	for {
+		mac := hmac.New(sha512.New, hdMasterKeySalt)
+		mac.Write(data)
+		I := mac.Sum(nil)
+
+		// the odds of an invalid key are about 2^-127, SLIP-0010 hashes again until the key is valid
+		key := new(big.Int).SetBytes(I[:32])
+		if key.Sign() != 0 && key.Cmp(elliptic.P256().Params().N) < 0 {
+			return &ExtendedKey{key, I[32:]}
+		}
+		data = I
+	}
+}
+
+// Child derives the child key at index, hardened when index is hardenedKeyStart or above
+func (k *ExtendedKey) Child(index uint32) *ExtendedKey {
+	var data []byte
+	if index >= hardenedKeyStart {
+		data = make([]byte, 33)
+		k.Key.FillBytes(data[1:])
+	} else {
+		public := k.PrivateKey().PublicKey
+		data = elliptic.MarshalCompressed(public.Curve, public.X, public.Y)
+	}
+	data = binary.BigEndian.AppendUint32(data, index)
+
+	n := elliptic.P256().Params().N
+	for {
+		mac := hmac.New(sha512.New, k.ChainCode)
+		mac.Write(data)
+		I := mac.Sum(nil)
+
+		tweak := new(big.Int).SetBytes(I[:32])
+		key := new(big.Int).Add(tweak, k.Key)
+		key.Mod(key, n)
+		if tweak.Cmp(n) < 0 && key.Sign() != 0 {
+			return &ExtendedKey{key, I[32:]}
+		}
+		// as SLIP-0010, hash the right half again rather than skipping the index
+		data = binary.BigEndian.AppendUint32(append([]byte{1}, I[32:]...), index)
+	}
+}
+
+// Derive follows a path of child indexes from k
+func (k *ExtendedKey) Derive(path ...uint32) *ExtendedKey {
+	for _, index := range path {
+		k = k.Child(index)
+	}
+	return k
+}
+
+// PrivateKey returns the ECDSA key pair of k
+func (k *ExtendedKey) PrivateKey() ecdsa.PrivateKey {
+	return privateKeyFromD(k.Key)
+}
+
+// Wallet returns the wallet of the key pair of k
+func (k *ExtendedKey) Wallet() *Wallet {
+	private := k.PrivateKey()
+	return &Wallet{private, pubKeyBytes(private.PublicKey)}
+}
+
+// hdAddressKey derives the key of the address at index from the seed of a wallet
+func hdAddressKey(seed []byte, index int) *ExtendedKey {
+	return NewMasterKey(seed).Derive(hdAddressPath...).Child(uint32(index))
+}
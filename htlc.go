@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+// defaultHTLCTimeout is how many blocks htlc create leaves the recipient to redeem a contract by default
+const defaultHTLCTimeout = 24
+
+// htlcSecretLen is the size of the secrets htlc create draws
+const htlcSecretLen = 32
+
+var (
+	// ErrNotHTLC is returned when an output isn't locked with a hash time-locked contract
+	ErrNotHTLC = errors.New("Output is not a hash time-locked contract")
+	// ErrWrongSecret is returned when a secret doesn't hash to the hash of a contract
+	ErrWrongSecret = errors.New("Secret doesn't match the hash of the contract")
+)
+
+// HTLC is a hash time-locked contract: the recipient can spend the output it locks with the secret whose SHA-256
+// hash is Hash, and from the height Timeout on, the sender can take the output back.
+// On two chains, contracts with the same hash make an atomic swap: redeeming one reveals the secret redeeming
+// the other. The one who drew the secret gives its contract the longer timeout
+type HTLC struct {
+	Hash      []byte
+	Recipient []byte // hash of the public key redeeming with the secret
+	Sender    []byte // hash of the public key refunded after the timeout
+	Timeout   int
+}
+
+// Script returns the script locking the output of the contract,
+// IF <hash> HASHLOCK DUP HASH160 <recipient> ELSE <timeout> TIMELOCK DUP HASH160 <sender> ENDIF EQUALVERIFY CHECKSIG
+func (h *HTLC) Script() Script {
+	return Script{}.
+		AddOp(opIf).AddData(h.Hash).AddOp(opHashLock).AddOp(opDup).AddOp(opHash160).AddData(h.Recipient).
+		AddOp(opElse).AddInt(h.Timeout).AddOp(opTimeLock).AddOp(opDup).AddOp(opHash160).AddData(h.Sender).
+		AddOp(opEndIf).AddOp(opEqualVerify).AddOp(opCheckSig)
+}
+
+// ParseHTLC returns the contract of a script made by HTLC.Script
+func ParseHTLC(script Script) (*HTLC, error) {
+	ops, err := script.parse()
+	if err != nil || len(ops) != 15 {
+		return nil, ErrNotHTLC
+	}
+	timeout, err := decodeScriptInt(ops[7].data)
+	if err != nil {
+		return nil, ErrNotHTLC
+	}
+
+	h := &HTLC{ops[1].data, ops[5].data, ops[11].data, timeout}
+	if !bytes.Equal(h.Script(), script) {
+		return nil, ErrNotHTLC
+	}
+	return h, nil
+}
+
+// RedeemScript returns the unlocking script of the recipient, revealing secret
+func (h *HTLC) RedeemScript(signature, pubKey, secret []byte) Script {
+	return Script{}.AddData(signature).AddData(pubKey).AddData(secret).AddData([]byte{1})
+}
+
+// RefundScript returns the unlocking script of the sender
+func (h *HTLC) RefundScript(signature, pubKey []byte) Script {
+	return Script{}.AddData(signature).AddData(pubKey).AddData(nil)
+}
+
+// HTLCSecret returns the secret revealed by an input redeeming a contract
+func (in *TxInput) HTLCSecret() ([]byte, bool) {
+	ops, err := in.Script.parse()
+	if err != nil || len(ops) != 4 || ops[2].data == nil || !scriptBool(ops[3].data) {
+		return nil, false
+	}
+	return ops[2].data, true
+}
+
+// NewHTLCTransaction generates a transaction locking amount with a contract, spending outputs of wallet
+func NewHTLCTransaction(wallet *Wallet, h *HTLC, amount, fee int, selector CoinSelector, UTXOSet *UTXOSet) (*Transaction, error) {
+	if amount <= 0 {
+		return nil, fmt.Errorf("%w: amount %d is not positive", ErrInvalidPayment, amount)
+	}
+	return newSignedTransaction(wallet, []TxOutput{*NewScriptOutput(amount, h.Script())}, fee, 0, selector, UTXOSet)
+}
+
+// NewHTLCRedeemTransaction generates a transaction spending the contract output vout of prevTx with secret,
+// paying its value but fee to the recipient, whose wallet signs it for the chain starting with the block genesis
+func NewHTLCRedeemTransaction(wallet *Wallet, prevTx *Transaction, vout int, secret []byte, fee int, genesis []byte) (*Transaction, error) {
+	h, err := outputHTLC(prevTx, vout)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(HashPubKey(wallet.PublicKey), h.Recipient) {
+		return nil, fmt.Errorf("The contract pays %s, not %s", PubKeyHashToAddress(h.Recipient), wallet.GetAddress())
+	}
+	hash := sha256.Sum256(secret)
+	if !bytes.Equal(hash[:], h.Hash) {
+		return nil, ErrWrongSecret
+	}
+
+	return spendHTLC(wallet, prevTx, vout, fee, genesis, func(signature []byte) Script {
+		return h.RedeemScript(signature, wallet.PublicKey, secret)
+	})
+}
+
+// NewHTLCRefundTransaction generates a transaction giving the contract output vout of prevTx back to the sender,
+// whose wallet signs it for the chain starting with the block genesis. It can only be in blocks from the timeout
+// of the contract on
+func NewHTLCRefundTransaction(wallet *Wallet, prevTx *Transaction, vout, fee int, genesis []byte) (*Transaction, error) {
+	h, err := outputHTLC(prevTx, vout)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(HashPubKey(wallet.PublicKey), h.Sender) {
+		return nil, fmt.Errorf("The contract refunds %s, not %s", PubKeyHashToAddress(h.Sender), wallet.GetAddress())
+	}
+
+	return spendHTLC(wallet, prevTx, vout, fee, genesis, func(signature []byte) Script {
+		return h.RefundScript(signature, wallet.PublicKey)
+	})
+}
+
+// outputHTLC returns the contract locking the output vout of tx
+func outputHTLC(tx *Transaction, vout int) (*HTLC, error) {
+	if vout < 0 || vout >= len(tx.Vout) {
+		return nil, fmt.Errorf("Transaction %x has no output %d", tx.ID, vout)
+	}
+	return ParseHTLC(tx.Vout[vout].Script)
+}
+
+// spendHTLC generates a transaction paying the whole output vout of prevTx but fee to wallet, unlocked by the
+// script unlock makes with the signature of wallet
+func spendHTLC(wallet *Wallet, prevTx *Transaction, vout, fee int, genesis []byte, unlock func(signature []byte) Script) (*Transaction, error) {
+	value := prevTx.Vout[vout].Value - fee
+	if fee < 0 || value <= 0 {
+		return nil, fmt.Errorf("%w: a fee of %d out of %d", ErrInvalidPayment, fee, prevTx.Vout[vout].Value)
+	}
+
+	tx := Transaction{nil, []TxInput{{Txid: prevTx.ID, Vout: vout}}, []TxOutput{*NewTxOutput(value, string(wallet.GetAddress()))}, 0}
+	tx.Vin[0].Script = unlock(signHash(wallet.PrivateKey, tx.sigHash(0, prevTx.Vout[vout], genesis)))
+	tx.finalize()
+
+	return &tx, nil
+}
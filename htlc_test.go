@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func TestHTLCSwap(t *testing.T) {
+	defer useTestDir(t)()
+
+	// alice has coins on chain A and wants coins of bob on chain B. Both chains paid their genesis reward to
+	// alice, only their genesis data tells them apart
+	alice, bob := NewWallet(), NewWallet()
+	bcA, err := CreateBlockchain(string(alice.GetAddress()), "chain A", "A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bcA.Close()
+	bcB, err := CreateBlockchain(string(alice.GetAddress()), "chain B", "B")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bcB.Close()
+	bcB.MineBlock([]*Transaction{NewCoinbaseTX(string(bob.GetAddress()), "")})
+
+	secret := make([]byte, htlcSecretLen)
+	if _, err := rand.Read(secret); err != nil {
+		t.Fatal(err)
+	}
+	hash := sha256.Sum256(secret)
+
+	// alice drew the secret, her contract times out last
+	contractA := &HTLC{hash[:], HashPubKey(bob.PublicKey), HashPubKey(alice.PublicKey), bcA.GetBestHeight() + 20}
+	lockA, err := NewHTLCTransaction(alice, contractA, 6, 1, nil, &UTXOSet{bcA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bcA.VerifyTransaction(lockA) {
+		t.Fatal("chain A rejects the contract of alice")
+	}
+
+	// a transaction signed for chain A can't be replayed on chain B, even with the outputs it spends
+	if bcB.VerifyTransaction(lockA) {
+		t.Error("chain B accepts the contract signed for chain A")
+	}
+	prevTxs := map[string]Transaction{}
+	for _, vin := range lockA.Vin {
+		prevTx, err := bcA.FindTransaction(vin.Txid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		prevTxs[hex.EncodeToString(prevTx.ID)] = prevTx
+	}
+	if lockA.Verify(prevTxs, 1, bcB.GenesisHash()) {
+		t.Error("the signatures of the contract of alice are valid on chain B")
+	}
+	bcA.MineBlock([]*Transaction{NewRewardTX(string(alice.GetAddress()), "", subsidy+1), lockA})
+
+	contractB := &HTLC{hash[:], HashPubKey(alice.PublicKey), HashPubKey(bob.PublicKey), bcB.GetBestHeight() + 10}
+	lockB, err := NewHTLCTransaction(bob, contractB, 4, 1, nil, &UTXOSet{bcB})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bcB.MineBlock([]*Transaction{NewRewardTX(string(bob.GetAddress()), "", subsidy+1), lockB})
+
+	if _, err := NewHTLCRedeemTransaction(alice, lockB, 0, []byte("guess"), 1, bcB.GenesisHash()); !errors.Is(err, ErrWrongSecret) {
+		t.Errorf("redeem with a wrong secret: got %v, want %v", err, ErrWrongSecret)
+	}
+	if _, err := NewHTLCRedeemTransaction(bob, lockB, 0, secret, 1, bcB.GenesisHash()); err == nil {
+		t.Error("bob redeems the contract paying alice")
+	}
+	refundB, err := NewHTLCRefundTransaction(bob, lockB, 0, 1, bcB.GenesisHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bcB.VerifyTransaction(refundB) {
+		t.Error("chain B accepts a refund before the timeout")
+	}
+
+	// alice redeems on chain B, revealing the secret
+	redeemB, err := NewHTLCRedeemTransaction(alice, lockB, 0, secret, 1, bcB.GenesisHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bcB.VerifyTransaction(redeemB) {
+		t.Fatal("chain B rejects the redeem of alice")
+	}
+	bcB.MineBlock([]*Transaction{NewRewardTX(string(bob.GetAddress()), "", subsidy+1), redeemB})
+
+	// bob reads it from chain B and redeems on chain A
+	spending, err := bcB.FindSpendingTransaction(lockB.ID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revealed, ok := spending.Vin[0].HTLCSecret()
+	if !ok || !bytes.Equal(revealed, secret) {
+		t.Fatalf("revealed secret %x, want %x", revealed, secret)
+	}
+	redeemA, err := NewHTLCRedeemTransaction(bob, lockA, 0, revealed, 1, bcA.GenesisHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bcA.VerifyTransaction(redeemA) {
+		t.Fatal("chain A rejects the redeem of bob")
+	}
+	bcA.MineBlock([]*Transaction{NewRewardTX(string(alice.GetAddress()), "", subsidy+1), redeemA})
+
+	if got := balanceOf(bcA, bob); got != 5 {
+		t.Errorf("balance of bob on chain A = %d, want 5", got)
+	}
+	if got := balanceOf(bcB, alice); got != subsidy+3 {
+		t.Errorf("balance of alice on chain B = %d, want %d", got, subsidy+3)
+	}
+	for _, bc := range []*Blockchain{bcA, bcB} {
+		if _, err := bc.Validate(false); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestHTLCRefund(t *testing.T) {
+	defer useTestDir(t)()
+
+	alice, bob := NewWallet(), NewWallet()
+	bc, err := CreateBlockchain(string(alice.GetAddress()), "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.Close()
+
+	hash := sha256.Sum256([]byte("secret"))
+	h := &HTLC{hash[:], HashPubKey(bob.PublicKey), HashPubKey(alice.PublicKey), 3}
+	if parsed, err := ParseHTLC(h.Script()); err != nil || parsed.Timeout != h.Timeout || !bytes.Equal(parsed.Sender, h.Sender) {
+		t.Fatalf("contract parsed as %v, %v", parsed, err)
+	}
+	if _, err := ParseHTLC(payToPubKeyHashScript(h.Recipient)); !errors.Is(err, ErrNotHTLC) {
+		t.Errorf("standard script: got %v, want %v", err, ErrNotHTLC)
+	}
+
+	lock, err := NewHTLCTransaction(alice, h, 6, 0, nil, &UTXOSet{bc})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc.MineBlock([]*Transaction{NewCoinbaseTX(string(alice.GetAddress()), ""), lock})
+
+	if _, err := NewHTLCRefundTransaction(bob, lock, 0, 1, bc.GenesisHash()); err == nil {
+		t.Error("bob takes the refund of alice")
+	}
+	refund, err := NewHTLCRefundTransaction(alice, lock, 0, 1, bc.GenesisHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bc.VerifyTransaction(refund) {
+		t.Fatal("the refund is valid in block 2, before the timeout")
+	}
+	bc.MineBlock([]*Transaction{NewCoinbaseTX(string(alice.GetAddress()), "")})
+	if !bc.VerifyTransaction(refund) {
+		t.Fatal("the refund is invalid in block 3, at the timeout")
+	}
+	if _, ok := refund.Vin[0].HTLCSecret(); ok {
+		t.Error("the refund reveals a secret")
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// lockTimeThreshold separates the lock times that are block heights, below it, from Unix timestamps
+const lockTimeThreshold = 500000000
+
+// medianTimeSpan is the number of blocks whose median timestamp time locks are compared with
+// Unlike the timestamp of a single block, the median only moves forward
+const medianTimeSpan = 11
+
+// sequenceTimeFlag marks the relative locks of inputs counted in seconds instead of blocks
+// The bits below it hold the lock
+const sequenceTimeFlag = 1 << 22
+
+// sequenceLockMask extracts the relative lock from the sequence of an input
+const sequenceLockMask = sequenceTimeFlag - 1
+
+// ErrTransactionLocked is returned when a transaction can't be in a block yet because of its lock times
+var ErrTransactionLocked = errors.New("Transaction is locked")
+
+// chainPoint is where a block is in a chain, as far as lock times are concerned: its height and the median
+// timestamp of the blocks before it
+type chainPoint struct {
+	height     int
+	medianTime int64
+}
+
+// medianTime returns the median of timestamps, 0 when there are none
+func medianTime(timestamps []int64) int64 {
+	if len(timestamps) == 0 {
+		return 0
+	}
+	sorted := append([]int64{}, timestamps...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[len(sorted)/2]
+}
+
+// checkLockTimes checks that tx can be in a block at point at
+// spentAt holds for each input the point of the block with the output it spends, only read for the inputs
+// with a relative lock
+func checkLockTimes(tx *Transaction, at chainPoint, spentAt []chainPoint) error {
+	if tx.LockTime >= lockTimeThreshold {
+		if at.medianTime < int64(tx.LockTime) {
+			return fmt.Errorf("%w: until %s, the median time is %s", ErrTransactionLocked,
+				time.Unix(int64(tx.LockTime), 0).UTC().Format(time.RFC3339), time.Unix(at.medianTime, 0).UTC().Format(time.RFC3339))
+		}
+	} else if at.height < tx.LockTime {
+		return fmt.Errorf("%w: until height %d, the block has height %d", ErrTransactionLocked, tx.LockTime, at.height)
+	}
+
+	for inID, vin := range tx.Vin {
+		lock := vin.Sequence & sequenceLockMask
+		if lock == 0 {
+			continue
+		}
+		if vin.Sequence&sequenceTimeFlag != 0 {
+			if at.medianTime < spentAt[inID].medianTime+int64(lock) {
+				return fmt.Errorf("%w: input %d is locked for %d seconds after the output it spends", ErrTransactionLocked, inID, lock)
+			}
+		} else if at.height < spentAt[inID].height+lock {
+			return fmt.Errorf("%w: input %d is locked for %d blocks after the output it spends", ErrTransactionLocked, inID, lock)
+		}
+	}
+
+	return nil
+}
+
+// MedianTime returns the median timestamp of the medianTimeSpan blocks ending with the block of hash, 0 for
+// the empty hash before the genesis block
+func (bc *Blockchain) MedianTime(hash []byte) (int64, error) {
+	var timestamps []int64
+	for len(hash) != 0 && len(timestamps) < medianTimeSpan {
+		block, err := bc.GetBlock(hash)
+		if err != nil {
+			return 0, err
+		}
+		timestamps = append(timestamps, block.Timestamp)
+		hash = block.PrevBlockHash
+	}
+	return medianTime(timestamps), nil
+}
+
+// CheckLockTimes checks that the lock times of tx let it in the next block
+func (bc *Blockchain) CheckLockTimes(tx *Transaction) error {
+	return bc.checkLockTimesFrom(bc.tip, tx)
+}
+
+// checkLockTimesFrom checks the lock times of tx for the block following the block of hash from
+func (bc *Blockchain) checkLockTimesFrom(from []byte, tx *Transaction) error {
+	if tx.isCoinbase() {
+		return nil
+	}
+
+	parent, err := bc.GetBlock(from)
+	if err != nil {
+		return err
+	}
+	parentTime, err := bc.MedianTime(from)
+	if err != nil {
+		return err
+	}
+
+	spentAt := make([]chainPoint, len(tx.Vin))
+	for inID, vin := range tx.Vin {
+		if vin.Sequence&sequenceLockMask == 0 {
+			continue
+		}
+		_, block, err := bc.findTransactionBlockFrom(from, vin.Txid)
+		if err != nil {
+			return err
+		}
+		spentTime, err := bc.MedianTime(block.PrevBlockHash)
+		if err != nil {
+			return err
+		}
+		spentAt[inID] = chainPoint{block.Height, spentTime}
+	}
+
+	return checkLockTimes(tx, chainPoint{parent.Height + 1, parentTime}, spentAt)
+}
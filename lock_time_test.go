@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLockTimeKeepsTransactionPooled(t *testing.T) {
+	defer useTestDir(t)()
+
+	wallet := NewWallet()
+	address := string(wallet.GetAddress())
+	bc, err := CreateBlockchain(address, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.Close()
+
+	// the next block has height 1, the payment can't be mined before height 2
+	UTXOSet := UTXOSet{bc}
+	tx, err := NewPaymentTransaction(wallet, []Payment{{string(NewWallet().GetAddress()), 3}}, 1, 2, nil, &UTXOSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.CheckLockTimes(tx); !errors.Is(err, ErrTransactionLocked) {
+		t.Fatalf("got %v, want %v", err, ErrTransactionLocked)
+	}
+
+	early := nextBlock(t, bc, bc.tip, NewRewardTX(address, "", subsidy+1), tx)
+	if err := bc.AddBlock(early); !errors.Is(err, ErrInvalidBlock) {
+		t.Errorf("block mining a locked transaction: got %v, want %v", err, ErrInvalidBlock)
+	}
+
+	mempool := NewMempool(bc)
+	if err := mempool.Add(tx); err != nil {
+		t.Fatal(err)
+	}
+	if txs := mempool.Select(defaultMaxBlockTxs); len(txs) != 0 || mempool.Size() != 1 {
+		t.Fatalf("selected %d locked transactions, %d pooled", len(txs), mempool.Size())
+	}
+
+	bc.MineBlock([]*Transaction{NewCoinbaseTX(address, "")})
+	txs := mempool.Select(defaultMaxBlockTxs)
+	if len(txs) != 1 {
+		t.Fatalf("selected %d transactions at the lock height, want 1", len(txs))
+	}
+	block := nextBlock(t, bc, bc.tip, append([]*Transaction{NewRewardTX(address, "", subsidy+1)}, txs...)...)
+	if err := bc.AddBlock(block); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bc.Validate(false); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCheckLockTimes(t *testing.T) {
+	now := time.Now().Unix()
+	at := chainPoint{10, now}
+	spentAt := []chainPoint{{8, now - 600}}
+	in := TxInput{Txid: []byte{1}}
+
+	tests := []struct {
+		name     string
+		lockTime int
+		sequence int
+		locked   bool
+	}{
+		{"no lock", 0, 0, false},
+		{"height reached", 10, 0, false},
+		{"height not reached", 11, 0, true},
+		{"time reached", int(now), 0, false},
+		{"time not reached", int(now + 1), 0, true},
+		{"blocks elapsed", 0, 2, false},
+		{"blocks not elapsed", 0, 3, true},
+		{"seconds elapsed", 0, sequenceTimeFlag | 600, false},
+		{"seconds not elapsed", 0, sequenceTimeFlag | 601, true},
+	}
+	for _, test := range tests {
+		in.Sequence = test.sequence
+		tx := Transaction{nil, []TxInput{in}, nil, test.lockTime}
+		err := checkLockTimes(&tx, at, spentAt)
+		if test.locked != errors.Is(err, ErrTransactionLocked) {
+			t.Errorf("%s: got %v, locked: %v", test.name, err, test.locked)
+		}
+	}
+
+	if got := medianTime([]int64{5, 1, 4, 2, 3}); got != 3 {
+		t.Errorf("median time = %d, want 3", got)
+	}
+}
+
+func TestBlockTimestampAfterMedianTime(t *testing.T) {
+	defer useTestDir(t)()
+
+	address := string(NewWallet().GetAddress())
+	bc, err := CreateBlockchain(address, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.Close()
+
+	// blocks ahead of the clock, within the allowed drift, move the median time past it
+	ahead := time.Now().Unix() + maxFutureBlockTime/2
+	for i := 0; i < 3; i++ {
+		parent, err := bc.GetBlock(bc.tip)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := bc.AddBlock(newBlockAt(ahead+int64(i), []*Transaction{NewCoinbaseTX(address, "")}, parent.Hash, parent.Height+1, bc.nextTarget(parent.Hash))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	median, err := bc.MedianTime(bc.tip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if now := time.Now().Unix(); median <= now {
+		t.Fatalf("median time = %d, want it after the clock %d", median, now)
+	}
+
+	stale := newBlockAt(median, []*Transaction{NewCoinbaseTX(address, "")}, bc.tip, bc.GetBestHeight()+1, bc.nextTarget(bc.tip))
+	if err := bc.AddBlock(stale); !errors.Is(err, ErrInvalidBlock) {
+		t.Errorf("block at the median time: got %v, want %v", err, ErrInvalidBlock)
+	}
+
+	// mining follows the median time rather than the clock
+	if block := bc.MineBlock([]*Transaction{NewCoinbaseTX(address, "")}); block.Timestamp <= median {
+		t.Errorf("mined block timestamped %d, not after the median time %d", block.Timestamp, median)
+	}
+	if _, err := bc.Validate(true); err != nil {
+		t.Fatal(err)
+	}
+
+	appendBlock(t, bc, stale)
+	var invalid *ChainValidationError
+	if _, err := bc.Validate(true); !errors.As(err, &invalid) || invalid.Height != stale.Height {
+		t.Errorf("Validate = %v, want block %d invalid", err, stale.Height)
+	}
+}
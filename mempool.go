@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// defaultMaxBlockTxs is how many pooled transactions a miner puts in a block, besides its coinbase
+const defaultMaxBlockTxs = 100
+
+var (
+	// ErrTxInMempool is returned when adding a transaction that is already pooled
+	ErrTxInMempool = errors.New("Transaction is already in the mempool")
+	// ErrDoubleSpend is returned when a transaction spends an output that is already spent
+	ErrDoubleSpend = errors.New("Transaction spends an output that is already spent")
+	// ErrInvalidTransaction is returned when a transaction fails verification
+	ErrInvalidTransaction = errors.New("Transaction is invalid")
+)
+
+// Mempool holds verified transactions waiting to be mined
+// It isn't safe for concurrent use, the owner has to synchronize access along with the blockchain
+type Mempool struct {
+	bc *Blockchain
+	// txs - transactions keyed by hex encoded ID, order - their IDs in arrival order
+	txs   map[string]Transaction
+	order []string
+	// spent maps every output spent by a pooled transaction to the ID of that transaction
+	spent map[string]string
+}
+
+// NewMempool creates an empty mempool validating transactions against bc
+func NewMempool(bc *Blockchain) *Mempool {
+	return &Mempool{bc, make(map[string]Transaction), nil, make(map[string]string)}
+}
+
+// Add validates a transaction and adds it to the pool
+// Its inputs must be unspent on chain and not spent by another pooled transaction
+func (mp *Mempool) Add(tx *Transaction) error {
+	txID := hex.EncodeToString(tx.ID)
+	if _, ok := mp.txs[txID]; ok {
+		return ErrTxInMempool
+	}
+
+	err := mp.check(tx)
+	if err != nil {
+		return err
+	}
+
+	mp.txs[txID] = *tx
+	mp.order = append(mp.order, txID)
+	for _, vin := range tx.Vin {
+		mp.spent[outpoint(vin.Txid, vin.Vout)] = txID
+	}
+
+	return nil
+}
+
+// check validates a transaction against the chain and the other pooled transactions
+func (mp *Mempool) check(tx *Transaction) error {
+	if tx.isCoinbase() {
+		return fmt.Errorf("%w: coinbase transactions can't be pooled", ErrInvalidTransaction)
+	}
+	if bytes.Compare(tx.ID, tx.Hash()) != 0 {
+		return fmt.Errorf("%w: ID doesn't match the content", ErrInvalidTransaction)
+	}
+
+	UTXOSet := UTXOSet{mp.bc}
+	txID := hex.EncodeToString(tx.ID)
+	inputs := make(map[string]bool)
+
+	for _, vin := range tx.Vin {
+		key := outpoint(vin.Txid, vin.Vout)
+		if inputs[key] {
+			return fmt.Errorf("%w: %s is spent twice by the transaction", ErrDoubleSpend, key)
+		}
+		inputs[key] = true
+
+		if spender, ok := mp.spent[key]; ok && spender != txID {
+			return fmt.Errorf("%w: %s is spent by pooled transaction %s", ErrDoubleSpend, key, spender)
+		}
+		if !UTXOSet.IsUnspent(vin.Txid, vin.Vout) {
+			return fmt.Errorf("%w: %s is not in the UTXO set", ErrDoubleSpend, key)
+		}
+	}
+
+	if !mp.bc.VerifyTransaction(tx) {
+		return fmt.Errorf("%w: verification failed", ErrInvalidTransaction)
+	}
+
+	return nil
+}
+
+// Has tells whether the transaction with txID is pooled
+func (mp *Mempool) Has(txID []byte) bool {
+	_, ok := mp.txs[hex.EncodeToString(txID)]
+	return ok
+}
+
+// Get returns a pooled transaction
+func (mp *Mempool) Get(txID []byte) (Transaction, bool) {
+	tx, ok := mp.txs[hex.EncodeToString(txID)]
+	return tx, ok
+}
+
+// Size returns the number of pooled transactions
+func (mp *Mempool) Size() int {
+	return len(mp.txs)
+}
+
+// Remove drops a transaction from the pool
+func (mp *Mempool) Remove(txID []byte) {
+	id := hex.EncodeToString(txID)
+	tx, ok := mp.txs[id]
+	if !ok {
+		return
+	}
+
+	delete(mp.txs, id)
+	for _, vin := range tx.Vin {
+		delete(mp.spent, outpoint(vin.Txid, vin.Vout))
+	}
+	for i, pooledID := range mp.order {
+		if pooledID == id {
+			mp.order = append(mp.order[:i], mp.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// RemoveBlock evicts the transactions included in a block, and the pooled ones spending the same outputs
+func (mp *Mempool) RemoveBlock(block *Block) {
+	for _, tx := range block.Transactions {
+		mp.Remove(tx.ID)
+
+		if tx.isCoinbase() {
+			continue
+		}
+		for _, vin := range tx.Vin {
+			if spender, ok := mp.spent[outpoint(vin.Txid, vin.Vout)]; ok {
+				txID, _ := hex.DecodeString(spender)
+				mp.Remove(txID)
+			}
+		}
+	}
+}
+
+// AddLeftBehind pools again the transactions of blocks a reorganization disconnected, oldest first
+// Those the new main chain already has, or that don't verify on it anymore, are dropped
+func (mp *Mempool) AddLeftBehind(blocks []*Block) {
+	for _, block := range blocks {
+		for _, tx := range block.Transactions {
+			if !tx.isCoinbase() {
+				mp.Add(tx)
+			}
+		}
+	}
+}
+
+// Select returns up to max pooled transactions for a new block, oldest first
+// Transactions that became invalid, after a reorganization for instance, are evicted on the way. Transactions
+// whose lock times keep them out of the next block stay pooled
+func (mp *Mempool) Select(max int) []*Transaction {
+	var txs []*Transaction
+
+	for _, txID := range append([]string{}, mp.order...) {
+		if len(txs) >= max {
+			break
+		}
+
+		tx := mp.txs[txID]
+		if mp.check(&tx) != nil {
+			mp.Remove(tx.ID)
+			continue
+		}
+		if mp.bc.CheckLockTimes(&tx) != nil {
+			continue
+		}
+
+		txs = append(txs, &tx)
+	}
+
+	return txs
+}
+
+// outpoint identifies an output by the ID of its transaction and its index
+func outpoint(txID []byte, vout int) string {
+	return fmt.Sprintf("%x:%d", txID, vout)
+}
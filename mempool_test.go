@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func TestMempoolRejectsDoubleSpends(t *testing.T) {
+	defer useTestDir(t)()
+
+	wallet := NewWallet()
+	alice := string(NewWallet().GetAddress())
+	bob := string(NewWallet().GetAddress())
+
+	bc, err := CreateBlockchain(string(wallet.GetAddress()), "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.Close()
+
+	// both spend the genesis coinbase
+	UTXOSet := UTXOSet{bc}
+	toAlice := NewUTXOTransaction(wallet, alice, 3, 0, &UTXOSet)
+	toBob := NewUTXOTransaction(wallet, bob, 3, 0, &UTXOSet)
+
+	mempool := NewMempool(bc)
+	if err := mempool.Add(toAlice); err != nil {
+		t.Fatal(err)
+	}
+	if err := mempool.Add(toAlice); err != ErrTxInMempool {
+		t.Errorf("adding twice: got %v, want %v", err, ErrTxInMempool)
+	}
+	if err := mempool.Add(toBob); !errors.Is(err, ErrDoubleSpend) {
+		t.Errorf("conflicting transaction: got %v, want %v", err, ErrDoubleSpend)
+	}
+
+	txs := mempool.Select(defaultMaxBlockTxs)
+	if len(txs) != 1 {
+		t.Fatalf("selected %d transactions, want 1", len(txs))
+	}
+	block := bc.MineBlock(append([]*Transaction{NewCoinbaseTX(alice, "")}, txs...))
+	mempool.RemoveBlock(block)
+
+	if mempool.Size() != 0 {
+		t.Errorf("mempool has %d transactions after they were mined", mempool.Size())
+	}
+	// the output is now spent on chain
+	if err := mempool.Add(toBob); !errors.Is(err, ErrDoubleSpend) {
+		t.Errorf("spent on chain: got %v, want %v", err, ErrDoubleSpend)
+	}
+}
+
+// spendOutput builds a transaction paying the whole output vout of txID to an address
+func spendOutput(bc *Blockchain, wallet *Wallet, txID []byte, vout, value int, to string) *Transaction {
+	tx := Transaction{nil, []TxInput{{txID, vout, nil, wallet.PublicKey, nil, nil, nil, 0}}, []TxOutput{*NewTxOutput(value, to)}, 0}
+	bc.SignTransaction(&tx, wallet.PrivateKey)
+	tx.ID = tx.Hash()
+	return &tx
+}
+
+func TestMempoolSelectLimit(t *testing.T) {
+	defer useTestDir(t)()
+
+	wallet := NewWallet()
+	address := string(wallet.GetAddress())
+	bob := string(NewWallet().GetAddress())
+
+	bc, err := CreateBlockchain(address, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.Close()
+
+	// three coinbase outputs to spend independently
+	bc.MineBlock([]*Transaction{NewCoinbaseTX(address, "")})
+	bc.MineBlock([]*Transaction{NewCoinbaseTX(address, "")})
+
+	mempool := NewMempool(bc)
+	for txID := range bc.FindUTXO() {
+		id, _ := hex.DecodeString(txID)
+		if err := mempool.Add(spendOutput(bc, wallet, id, 0, subsidy, bob)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	first := mempool.Select(2)
+	if len(first) != 2 {
+		t.Fatalf("selected %d transactions, want 2", len(first))
+	}
+	mempool.RemoveBlock(bc.MineBlock(append([]*Transaction{NewCoinbaseTX(address, "")}, first...)))
+
+	second := mempool.Select(2)
+	if len(second) != 1 {
+		t.Fatalf("selected %d transactions, want the last one", len(second))
+	}
+	for _, tx := range first {
+		if bytes.Equal(tx.ID, second[0].ID) {
+			t.Errorf("transaction %x selected twice", tx.ID)
+		}
+	}
+}
+
+func TestMempoolAddLeftBehind(t *testing.T) {
+	defer useTestDir(t)()
+
+	wallet := NewWallet()
+	address := string(wallet.GetAddress())
+	bob := string(NewWallet().GetAddress())
+
+	bc, err := CreateBlockchain(address, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.Close()
+
+	genesis, err := bc.GetBlock(bc.tip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fork := bc.MineBlock([]*Transaction{NewCoinbaseTX(address, "fork")})
+
+	// the main chain mines both, the branch replacing it only the second one
+	first := spendOutput(bc, wallet, genesis.Transactions[0].ID, 0, subsidy, bob)
+	second := spendOutput(bc, wallet, fork.Transactions[0].ID, 0, subsidy, bob)
+	oldTip := bc.MineBlock([]*Transaction{NewCoinbaseTX(address, "main"), first, second})
+
+	if blocks, err := bc.LeftBehind(oldTip.Hash); err != nil || len(blocks) != 0 {
+		t.Fatalf("tip of the main chain: got %d blocks left behind and %v, want none", len(blocks), err)
+	}
+
+	b1 := branchBlock(fork, NewCoinbaseTX(address, "branch 1"), second)
+	b2 := branchBlock(b1, NewCoinbaseTX(address, "branch 2"))
+	for _, block := range []*Block{b1, b2} {
+		if err := bc.AddBlock(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(bc.tip, b2.Hash) {
+		t.Fatal("the longer branch is not the main chain")
+	}
+
+	blocks, err := bc.LeftBehind(oldTip.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 1 || !bytes.Equal(blocks[0].Hash, oldTip.Hash) {
+		t.Fatalf("got %d blocks left behind, want the old tip", len(blocks))
+	}
+
+	mempool := NewMempool(bc)
+	mempool.AddLeftBehind(blocks)
+	if mempool.Size() != 1 || !mempool.Has(first.ID) {
+		t.Errorf("mempool has %d transactions, want only the one the branch didn't mine", mempool.Size())
+	}
+}
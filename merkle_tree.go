@@ -1 +1,130 @@
 package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+)
+
+// MerkleTree is a binary hash tree built over the transactions of a block
+// levels[0] holds the leaves, the last level holds only the root. A level with an odd number of
+// nodes is padded by duplicating its last node, the same way bitcoin does. So repeating the last leaves
+// gives the same root, blocks must not repeat a transaction ID
+type MerkleTree struct {
+	RootNode *MerkleNode
+	levels   [][]*MerkleNode
+}
+
+// MerkleNode is a node of a MerkleTree, Data is the hash of the node
+type MerkleNode struct {
+	Left  *MerkleNode
+	Right *MerkleNode
+	Data  []byte
+}
+
+// MerkleProof proves a piece of data is a leaf of a MerkleTree
+// Hashes are the siblings from the leaf up to the root, and IsLeft tells whether each sibling sits on the left
+type MerkleProof struct {
+	Data   []byte
+	Hashes [][]byte
+	IsLeft []bool
+}
+
+// NewMerkleNode creates a node. A leaf hashes data, an inner node hashes the concatenation of its children
+func NewMerkleNode(left, right *MerkleNode, data []byte) *MerkleNode {
+	node := MerkleNode{}
+
+	if left == nil && right == nil {
+		hash := sha256.Sum256(data)
+		node.Data = hash[:]
+	} else {
+		prevHashes := append(append([]byte{}, left.Data...), right.Data...)
+		hash := sha256.Sum256(prevHashes)
+		node.Data = hash[:]
+	}
+
+	node.Left = left
+	node.Right = right
+
+	return &node
+}
+
+// ErrEmptyMerkleTree is returned when a merkle tree is built without leaves
+var ErrEmptyMerkleTree = errors.New("Merkle tree needs at least one leaf")
+
+// NewMerkleTree builds a MerkleTree from a list of data
+func NewMerkleTree(data [][]byte) (*MerkleTree, error) {
+	if len(data) == 0 {
+		return nil, ErrEmptyMerkleTree
+	}
+
+	var nodes []*MerkleNode
+	for _, datum := range data {
+		nodes = append(nodes, NewMerkleNode(nil, nil, datum))
+	}
+
+	var levels [][]*MerkleNode
+	for {
+		if len(nodes) > 1 && len(nodes)%2 != 0 {
+			nodes = append(nodes, nodes[len(nodes)-1])
+		}
+		levels = append(levels, nodes)
+
+		if len(nodes) == 1 {
+			break
+		}
+
+		var level []*MerkleNode
+		for i := 0; i < len(nodes); i += 2 {
+			level = append(level, NewMerkleNode(nodes[i], nodes[i+1], nil))
+		}
+		nodes = level
+	}
+
+	return &MerkleTree{nodes[0], levels}, nil
+}
+
+// Proof returns an inclusion proof for data, which must be one of the leaves the tree was built from
+func (t *MerkleTree) Proof(data []byte) (*MerkleProof, error) {
+	leafHash := sha256.Sum256(data)
+	index := -1
+
+	for i, leaf := range t.levels[0] {
+		if bytes.Compare(leaf.Data, leafHash[:]) == 0 {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return nil, errors.New("Data is not in the merkle tree")
+	}
+
+	proof := MerkleProof{Data: data}
+	for _, level := range t.levels[:len(t.levels)-1] {
+		sibling := index ^ 1
+		proof.Hashes = append(proof.Hashes, level[sibling].Data)
+		proof.IsLeft = append(proof.IsLeft, sibling < index)
+		index /= 2
+	}
+
+	return &proof, nil
+}
+
+// Verify checks the proof leads from its data to the given merkle root
+func (p *MerkleProof) Verify(root []byte) bool {
+	if len(p.Hashes) != len(p.IsLeft) {
+		return false
+	}
+
+	node := NewMerkleNode(nil, nil, p.Data)
+	for i, hash := range p.Hashes {
+		sibling := &MerkleNode{Data: hash}
+		if p.IsLeft[i] {
+			node = NewMerkleNode(sibling, node, nil)
+		} else {
+			node = NewMerkleNode(node, sibling, nil)
+		}
+	}
+
+	return bytes.Compare(node.Data, root) == 0
+}
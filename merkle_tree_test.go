@@ -1 +1,112 @@
 package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func hashOf(data ...[]byte) []byte {
+	hash := sha256.Sum256(bytes.Join(data, []byte{}))
+	return hash[:]
+}
+
+func TestNewMerkleNode(t *testing.T) {
+	left := NewMerkleNode(nil, nil, []byte("node1"))
+	right := NewMerkleNode(nil, nil, []byte("node2"))
+	parent := NewMerkleNode(left, right, nil)
+
+	if !bytes.Equal(left.Data, hashOf([]byte("node1"))) {
+		t.Errorf("leaf hash = %x, want %x", left.Data, hashOf([]byte("node1")))
+	}
+	if !bytes.Equal(parent.Data, hashOf(left.Data, right.Data)) {
+		t.Errorf("parent hash = %x, want %x", parent.Data, hashOf(left.Data, right.Data))
+	}
+}
+
+func TestNewMerkleTreeOddLeaves(t *testing.T) {
+	data := [][]byte{[]byte("node1"), []byte("node2"), []byte("node3")}
+
+	// the third leaf is paired with itself
+	n1 := hashOf(data[0])
+	n2 := hashOf(data[1])
+	n3 := hashOf(data[2])
+	root := hashOf(hashOf(n1, n2), hashOf(n3, n3))
+
+	tree, err := NewMerkleTree(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(tree.RootNode.Data, root) {
+		t.Errorf("root = %x, want %x", tree.RootNode.Data, root)
+	}
+}
+
+func TestNewMerkleTreeSingleLeaf(t *testing.T) {
+	tree, err := NewMerkleTree([][]byte{[]byte("node1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(tree.RootNode.Data, hashOf([]byte("node1"))) {
+		t.Errorf("root = %x, want the leaf hash", tree.RootNode.Data)
+	}
+}
+
+func TestNewMerkleTreeEmpty(t *testing.T) {
+	if _, err := NewMerkleTree(nil); !errors.Is(err, ErrEmptyMerkleTree) {
+		t.Errorf("got %v, want %v", err, ErrEmptyMerkleTree)
+	}
+}
+
+func TestMerkleProof(t *testing.T) {
+	for size := 1; size <= 9; size++ {
+		var data [][]byte
+		for i := 0; i < size; i++ {
+			data = append(data, []byte(fmt.Sprintf("tx%d", i)))
+		}
+		tree, err := NewMerkleTree(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, datum := range data {
+			proof, err := tree.Proof(datum)
+			if err != nil {
+				t.Fatalf("size %d: proof for %s: %v", size, datum, err)
+			}
+			if !proof.Verify(tree.RootNode.Data) {
+				t.Errorf("size %d: proof for %s doesn't verify", size, datum)
+			}
+		}
+	}
+}
+
+func TestMerkleProofRejectsTampering(t *testing.T) {
+	data := [][]byte{[]byte("tx0"), []byte("tx1"), []byte("tx2"), []byte("tx3"), []byte("tx4")}
+	tree, err := NewMerkleTree(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := tree.Proof([]byte("tx5")); err == nil {
+		t.Error("expected an error for data that is not a leaf")
+	}
+
+	proof, err := tree.Proof([]byte("tx2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proof.Data = []byte("tx5")
+	if proof.Verify(tree.RootNode.Data) {
+		t.Error("proof verified with different data")
+	}
+	proof.Data = []byte("tx2")
+
+	proof.IsLeft[0] = !proof.IsLeft[0]
+	if proof.Verify(tree.RootNode.Data) {
+		t.Error("proof verified with a flipped sibling side")
+	}
+}
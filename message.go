@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+)
+
+// messageTag separates the hashes of signed messages from those of transactions
+var messageTag = []byte("glockchain signed message")
+
+// ErrInvalidMessageSignature is returned when a message signature doesn't match the message or the address
+var ErrInvalidMessageSignature = errors.New("Message signature is not valid")
+
+// MessageHash returns the hash signed for a message, sha256(sha256(tag) || sha256(tag) || message)
+// Transactions sign sha256(hash of the trimmed copy || spent value || genesis hash), which only starts with
+// sha256(tag) if the gob encoding of the copy is the tag itself, so a message signature can't pass for a
+// transaction signature
+func MessageHash(message []byte) []byte {
+	tagHash := sha256.Sum256(messageTag)
+
+	data := append(append(tagHash[:], tagHash[:]...), message...)
+	hash := sha256.Sum256(data)
+	return hash[:]
+}
+
+// SignMessage proves the wallet owns its address, the signature is the r||s signature of the message hash
+// followed by the public key, which the address alone doesn't give
+func SignMessage(wallet *Wallet, message []byte) []byte {
+	return append(signHash(wallet.PrivateKey, MessageHash(message)), wallet.PublicKey...)
+}
+
+// VerifyMessage checks a signature made by SignMessage with the key of address
+func VerifyMessage(address string, signature, message []byte) error {
+	if !ValidateAddress(address) {
+		return errors.New("Address is not valid")
+	}
+	// the signature and the key are both made of two coordinates of the curve
+	if len(signature) == 0 || len(signature)%4 != 0 {
+		return ErrInvalidMessageSignature
+	}
+	sig := signature[:len(signature)/2]
+	pubKey := signature[len(signature)/2:]
+
+	pubKeyHash := Base58Decode([]byte(address))
+	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-addressCheckSumLen]
+	if !bytes.Equal(HashPubKey(pubKey), pubKeyHash) {
+		return ErrInvalidMessageSignature
+	}
+	if !verifyHash(pubKey, MessageHash(message), sig) {
+		return ErrInvalidMessageSignature
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestSignMessage(t *testing.T) {
+	alice := NewWallet()
+	address := string(alice.GetAddress())
+	message := []byte("alice owns this address")
+
+	signature := SignMessage(alice, message)
+	err := VerifyMessage(address, signature, message)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	forged := SignMessage(NewWallet(), message)
+	for name, test := range map[string]struct {
+		address   string
+		signature []byte
+		message   []byte
+	}{
+		"other message": {address, signature, []byte("bob owns this address")},
+		"other address": {string(NewWallet().GetAddress()), signature, message},
+		"other key":     {address, forged, message},
+		"truncated":     {address, signature[:len(signature)-1], message},
+	} {
+		if err := VerifyMessage(test.address, test.signature, test.message); !errors.Is(err, ErrInvalidMessageSignature) {
+			t.Errorf("%s: got %v, want %v", name, err, ErrInvalidMessageSignature)
+		}
+	}
+}
+
+func TestMessageSignatureIsNotATransactionSignature(t *testing.T) {
+	alice := NewWallet()
+	tx := Transaction{nil, []TxInput{{[]byte{1}, 0, nil, nil, nil, nil, nil, 0}}, []TxOutput{{5, HashPubKey(alice.PublicKey), false, nil}}, 0}
+	prevTxs := map[string]Transaction{"01": {[]byte{1}, nil, []TxOutput{{5, HashPubKey(alice.PublicKey), false, nil}}, 0}}
+
+	// sign, as a message, exactly the bytes a transaction signature covers
+	txCopy := tx.TrimmedCopy()
+	txCopy.Vin[0].PubKey = HashPubKey(alice.PublicKey)
+	signature := SignMessage(alice, bytes.Join([][]byte{txCopy.Hash(), IntToHex(5)}, []byte{}))
+
+	tx.Vin[0].PubKey = alice.PublicKey
+	tx.Vin[0].Signature = signature[:len(signature)/2]
+	if tx.Verify(prevTxs, 1, nil) {
+		t.Error("a message signature passes for a transaction signature")
+	}
+
+	tx.Sign(alice.PrivateKey, prevTxs, nil)
+	if !tx.Verify(prevTxs, 1, nil) {
+		t.Error("the transaction signature doesn't verify")
+	}
+}
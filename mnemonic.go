@@ -0,0 +1,103 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// mnemonicEntropyLen is the size in bytes of the entropy of new mnemonics, which gives 12 words
+const mnemonicEntropyLen = 16
+
+// mnemonicSeedIterations is the PBKDF2 iteration count BIP39 uses to stretch a mnemonic into a seed
+const mnemonicSeedIterations = 2048
+
+// ErrInvalidMnemonic is returned when a mnemonic has unknown words, a wrong number of words or a wrong checksum
+var ErrInvalidMnemonic = errors.New("Mnemonic is not valid")
+
+var mnemonicWordIndex = func() map[string]int {
+	index := make(map[string]int, len(mnemonicWords))
+	for i, word := range mnemonicWords {
+		index[word] = i
+	}
+	return index
+}()
+
+// NewMnemonic returns a mnemonic encoding fresh random entropy
+func NewMnemonic() (string, error) {
+	entropy := make([]byte, mnemonicEntropyLen)
+	_, err := rand.Read(entropy)
+	if err != nil {
+		return "", err
+	}
+	return EntropyToMnemonic(entropy)
+}
+
+// EntropyToMnemonic encodes entropy as words, 11 bits each, the last bits being a checksum of the entropy
+// The entropy is 16 to 32 bytes, a multiple of 4
+func EntropyToMnemonic(entropy []byte) (string, error) {
+	if len(entropy) < 16 || len(entropy) > 32 || len(entropy)%4 != 0 {
+		return "", fmt.Errorf("Mnemonic entropy can't be %d bytes", len(entropy))
+	}
+
+	checksumBits := uint(len(entropy) * 8 / 32)
+	hash := sha256.Sum256(entropy)
+	bits := new(big.Int).SetBytes(entropy)
+	bits.Lsh(bits, checksumBits)
+	bits.Or(bits, big.NewInt(int64(hash[0]>>(8-checksumBits))))
+
+	words := make([]string, (len(entropy)*8+int(checksumBits))/11)
+	mask := big.NewInt(2047)
+	for i := len(words) - 1; i >= 0; i-- {
+		words[i] = mnemonicWords[new(big.Int).And(bits, mask).Int64()]
+		bits.Rsh(bits, 11)
+	}
+
+	return strings.Join(words, " "), nil
+}
+
+// MnemonicToEntropy decodes a mnemonic back into its entropy, checking its words and checksum
+func MnemonicToEntropy(mnemonic string) ([]byte, error) {
+	words := strings.Fields(mnemonic)
+	if len(words) < 12 || len(words) > 24 || len(words)%3 != 0 {
+		return nil, fmt.Errorf("%w: %d words", ErrInvalidMnemonic, len(words))
+	}
+
+	bits := new(big.Int)
+	for _, word := range words {
+		i, ok := mnemonicWordIndex[word]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown word %q", ErrInvalidMnemonic, word)
+		}
+		bits.Lsh(bits, 11)
+		bits.Or(bits, big.NewInt(int64(i)))
+	}
+
+	checksumBits := uint(len(words) / 3)
+	checksum := new(big.Int).And(bits, big.NewInt(1<<checksumBits-1)).Int64()
+	entropy := make([]byte, (len(words)*11-int(checksumBits))/8)
+	bits.Rsh(bits, checksumBits).FillBytes(entropy)
+
+	hash := sha256.Sum256(entropy)
+	if int64(hash[0]>>(8-checksumBits)) != checksum {
+		return nil, fmt.Errorf("%w: wrong checksum", ErrInvalidMnemonic)
+	}
+	return entropy, nil
+}
+
+// MnemonicToSeed stretches a valid mnemonic and an optional passphrase into the 64 bytes seed of an HD wallet
+func MnemonicToSeed(mnemonic, passphrase string) ([]byte, error) {
+	_, err := MnemonicToEntropy(mnemonic)
+	if err != nil {
+		return nil, err
+	}
+
+	normalized := strings.Join(strings.Fields(mnemonic), " ")
+	return pbkdf2.Key([]byte(normalized), []byte("mnemonic"+passphrase), mnemonicSeedIterations, 64, sha512.New), nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestMnemonicVectors(t *testing.T) {
+	// test vectors of BIP39, the seeds use the passphrase TREZOR
+	tests := []struct {
+		entropy  string
+		mnemonic string
+		seed     string
+	}{
+		{
+			"00000000000000000000000000000000",
+			"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+			"c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04",
+		},
+		{
+			"7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f",
+			"legal winner thank year wave sausage worth useful legal winner thank yellow",
+			"2e8905819b8723fe2c1d161860e5ee1830318dbf49a83bd451cfb8440c28bd6fa457fe1296106559a3c80937a1c1069be3a3a5bd381ee6260e8d9739fce1f607",
+		},
+		{
+			"80808080808080808080808080808080",
+			"letter advice cage absurd amount doctor acoustic avoid letter advice cage above",
+			"",
+		},
+		{
+			"ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff",
+			strings.Repeat("zoo ", 23) + "vote",
+			"",
+		},
+	}
+
+	for _, test := range tests {
+		entropy, _ := hex.DecodeString(test.entropy)
+		mnemonic, err := EntropyToMnemonic(entropy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mnemonic != test.mnemonic {
+			t.Errorf("EntropyToMnemonic(%s) = %q, want %q", test.entropy, mnemonic, test.mnemonic)
+		}
+
+		decoded, err := MnemonicToEntropy(test.mnemonic)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(decoded, entropy) {
+			t.Errorf("MnemonicToEntropy(%q) = %x, want %s", test.mnemonic, decoded, test.entropy)
+		}
+
+		if test.seed == "" {
+			continue
+		}
+		seed, err := MnemonicToSeed(test.mnemonic, "TREZOR")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hex.EncodeToString(seed) != test.seed {
+			t.Errorf("MnemonicToSeed(%q) = %x, want %s", test.mnemonic, seed, test.seed)
+		}
+	}
+}
+
+func TestInvalidMnemonics(t *testing.T) {
+	for _, mnemonic := range []string{
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon",
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon bitcoin",
+	} {
+		if _, err := MnemonicToSeed(mnemonic, ""); !errors.Is(err, ErrInvalidMnemonic) {
+			t.Errorf("MnemonicToSeed(%q): got %v, want %v", mnemonic, err, ErrInvalidMnemonic)
+		}
+	}
+}
+
+func TestHDKeyVectors(t *testing.T) {
+	// test vector 1 of SLIP-0010 for nist256p1
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	tests := []struct {
+		path      []uint32
+		chainCode string
+		key       string
+	}{
+		{nil, "beeb672fe4621673f722f38529c07392fecaa61015c80c34f29ce8b41b3cb6ea", "612091aaa12e22dd2abef664f8a01a82cae99ad7441b7ef8110424915c268bc2"},
+		{[]uint32{hardenedKeyStart}, "3460cea53e6a6bb5fb391eeef3237ffd8724bf0a40e94943c98b83825342ee11", "6939694369114c67917a182c59ddb8cafc3004e63ca5d3b84403ba8613debc0c"},
+	}
+
+	for _, test := range tests {
+		key := NewMasterKey(seed).Derive(test.path...)
+		if hex.EncodeToString(key.ChainCode) != test.chainCode {
+			t.Errorf("chain code of %v = %x, want %s", test.path, key.ChainCode, test.chainCode)
+		}
+		if got := hex.EncodeToString(key.Key.FillBytes(make([]byte, 32))); got != test.key {
+			t.Errorf("key of %v = %s, want %s", test.path, got, test.key)
+		}
+	}
+}
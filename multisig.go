@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// maxMultisigKeys bounds the number of keys of a multisig policy, which must fit in a byte
+const maxMultisigKeys = 16
+
+// ErrInvalidMultisig is returned when a multisig policy has an invalid number of keys or an invalid key
+var ErrInvalidMultisig = errors.New("Multisig policy is not valid")
+
+// Multisig is an M-of-N policy: Required signatures of the keys of PubKeys unlock the outputs of its address
+// Outputs only hold the hash of the policy, the inputs spending them reveal it along with the signatures
+type Multisig struct {
+	Required int
+	PubKeys  [][]byte
+}
+
+// NewMultisig returns the policy requiring required signatures among pubKeys, in this order
+func NewMultisig(required int, pubKeys [][]byte) (*Multisig, error) {
+	m := Multisig{required, pubKeys}
+	err := m.check()
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// check rejects policies that can't be satisfied, have too many keys, invalid or repeated keys
+func (m *Multisig) check() error {
+	if len(m.PubKeys) == 0 || len(m.PubKeys) > maxMultisigKeys {
+		return fmt.Errorf("%w: %d keys", ErrInvalidMultisig, len(m.PubKeys))
+	}
+	if m.Required < 1 || m.Required > len(m.PubKeys) {
+		return fmt.Errorf("%w: %d of %d signatures", ErrInvalidMultisig, m.Required, len(m.PubKeys))
+	}
+
+	curve := elliptic.P256()
+	keyLen := (curve.Params().BitSize + 7) / 8
+	for i, pubKey := range m.PubKeys {
+		if len(pubKey) != 2*keyLen || !curve.IsOnCurve(new(big.Int).SetBytes(pubKey[:keyLen]), new(big.Int).SetBytes(pubKey[keyLen:])) {
+			return fmt.Errorf("%w: key %d is not a public key", ErrInvalidMultisig, i+1)
+		}
+		if m.KeyIndex(pubKey) != i {
+			return fmt.Errorf("%w: key %d is repeated", ErrInvalidMultisig, i+1)
+		}
+	}
+	return nil
+}
+
+// Serialize encodes the policy as the number of required signatures, the number of keys and the keys
+func (m *Multisig) Serialize() []byte {
+	data := []byte{byte(m.Required), byte(len(m.PubKeys))}
+	for _, pubKey := range m.PubKeys {
+		data = append(data, pubKey...)
+	}
+	return data
+}
+
+// DeserializeMultisig decodes a policy encoded by Serialize
+func DeserializeMultisig(data []byte) (*Multisig, error) {
+	if len(data) < 2 || len(data) != 2+int(data[1])*64 {
+		return nil, fmt.Errorf("%w: %d bytes", ErrInvalidMultisig, len(data))
+	}
+	var pubKeys [][]byte
+	for i := 2; i < len(data); i += 64 {
+		pubKeys = append(pubKeys, data[i:i+64])
+	}
+	return NewMultisig(int(data[0]), pubKeys)
+}
+
+// Hash returns the hash outputs paid to the policy are locked with
+func (m *Multisig) Hash() []byte {
+	return HashPubKey(m.Serialize())
+}
+
+// Address returns the multisig address of the policy
+func (m *Multisig) Address() []byte {
+	return hashToAddress(multisigVersion, m.Hash())
+}
+
+// KeyIndex returns the position of pubKey in the policy, or -1
+func (m *Multisig) KeyIndex(pubKey []byte) int {
+	for i, key := range m.PubKeys {
+		if bytes.Equal(key, pubKey) {
+			return i
+		}
+	}
+	return -1
+}
+
+// verify checks signatures of hash, one slot per key with nil for the keys that didn't sign
+// Every signature given must be valid, and there must be at least Required of them
+func (m *Multisig) verify(hash []byte, signatures [][]byte) bool {
+	if m.check() != nil || len(signatures) != len(m.PubKeys) {
+		return false
+	}
+
+	signed := 0
+	for i, signature := range signatures {
+		if signature == nil {
+			continue
+		}
+		if !verifyHash(m.PubKeys[i], hash, signature) {
+			return false
+		}
+		signed++
+	}
+	return signed >= m.Required
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMultisigSpending(t *testing.T) {
+	defer useTestDir(t)()
+
+	officers := []*Wallet{NewWallet(), NewWallet(), NewWallet()}
+	outsider := NewWallet()
+	policy, err := NewMultisig(2, [][]byte{officers[0].PublicKey, officers[1].PublicKey, officers[2].PublicKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := string(policy.Address())
+	if !ValidateAddress(address) {
+		t.Fatalf("multisig address %s is not valid", address)
+	}
+
+	bc, err := CreateBlockchain(address, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.Close()
+
+	UTXOSet := UTXOSet{bc}
+	if _, err := NewRawTransaction(address, []Payment{{string(outsider.GetAddress()), 5}}, 1, nil, &UTXOSet); err == nil {
+		t.Error("a multisig address is spent without its policy")
+	}
+	raw, err := NewMultisigRawTransaction(policy, []Payment{{string(outsider.GetAddress()), 5}}, 1, nil, &UTXOSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if signed, err := raw.Sign(outsider); err != nil || signed != 0 {
+		t.Errorf("signing with a key out of the policy: %d inputs, %v", signed, err)
+	}
+	if signed, err := raw.Sign(officers[2]); err != nil || signed != 1 {
+		t.Fatalf("signing with the first officer: %d inputs, %v", signed, err)
+	}
+	if err := raw.Verify(); !errors.Is(err, ErrIncompleteTransaction) {
+		t.Errorf("verifying with 1 of 2 signatures: got %v, want %v", err, ErrIncompleteTransaction)
+	}
+	if bc.VerifyTransaction(&raw.Tx) {
+		t.Error("the blockchain accepts 1 of 2 signatures")
+	}
+
+	if signed, err := raw.Sign(officers[0]); err != nil || signed != 1 {
+		t.Fatalf("signing with the second officer: %d inputs, %v", signed, err)
+	}
+	err = raw.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bc.VerifyTransaction(&raw.Tx) {
+		t.Error("the blockchain rejects 2 of 2 signatures")
+	}
+
+	// the change goes back to the multisig address
+	if string(raw.Tx.Vout[1].Address()) != address {
+		t.Errorf("change paid to %s, want %s", raw.Tx.Vout[1].Address(), address)
+	}
+
+	// a signature moved to the slot of another key doesn't count
+	raw.Tx.Vin[0].Signatures[1], raw.Tx.Vin[0].Signatures[2] = raw.Tx.Vin[0].Signatures[2], nil
+	if bc.VerifyTransaction(&raw.Tx) {
+		t.Error("the blockchain accepts a signature in the slot of another key")
+	}
+}
+
+func TestInvalidMultisig(t *testing.T) {
+	a, b := NewWallet(), NewWallet()
+	tests := []struct {
+		name     string
+		required int
+		pubKeys  [][]byte
+	}{
+		{"no keys", 1, nil},
+		{"more signatures than keys", 3, [][]byte{a.PublicKey, b.PublicKey}},
+		{"no signatures", 0, [][]byte{a.PublicKey, b.PublicKey}},
+		{"repeated key", 2, [][]byte{a.PublicKey, a.PublicKey}},
+		{"invalid key", 1, [][]byte{a.PublicKey, b.PublicKey[1:]}},
+	}
+	for _, test := range tests {
+		if _, err := NewMultisig(test.required, test.pubKeys); !errors.Is(err, ErrInvalidMultisig) {
+			t.Errorf("%s: got %v, want %v", test.name, err, ErrInvalidMultisig)
+		}
+	}
+}
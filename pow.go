@@ -10,34 +10,94 @@ import (
 
 var maxNonce = math.MaxInt64
 
-const targerBits int = 24
+const progressInterval = 100000
+
+// initialTargetBits is the difficulty of the genesis block, its hash needs that many leading 0 bits
+// It is also the easiest difficulty allowed. Tests lower it to mine quickly
+var initialTargetBits = 24
+
+// retargetInterval is the number of blocks after which the target is recomputed
+const retargetInterval = 10
+
+// targetBlockSpacing is the number of seconds expected between two blocks
+const targetBlockSpacing = 10
+
+// maxRetargetFactor bounds how much the target changes at once, both ways
+const maxRetargetFactor = 4
+
+// maxFutureBlockTime is how many seconds ahead of the local clock a block can be timestamped
+// Without a bound a miner could stretch the timespan of an interval, and make the next target easier
+const maxFutureBlockTime = 2 * 60
 
 // ProofOfWork defines the desired proof of work
 type ProofOfWork struct {
 	block  *Block
 	target *big.Int
+	// txHash is the merkle root of the block, computed once instead of for every nonce
+	txHash []byte
 }
 
 // NewProofOfWork is to generate a target for PoW
-// our target here is fixed, to generate a hash with 24 leading 0s in bits
-// because we use big int as the target, a successful target can be considered as genrating a number smaller than 1<<(256-24)
+// the target is the one recorded in the block, a valid hash is a number smaller than the target
 func NewProofOfWork(b *Block) *ProofOfWork {
-	target := big.NewInt(1)
-	// left shift
-	target.Lsh(target, uint(256-targerBits))
+	target := new(big.Int).SetBytes(b.Target)
 	// create a ProofOfWork instance conataining target and the original block
-	pow := &ProofOfWork{b, target}
+	pow := &ProofOfWork{b, target, b.HashTransactions()}
 	return pow
 }
 
-// prepareData simply combine a block with target and nonce
+// maxTarget returns the easiest target allowed, 1<<(256-initialTargetBits)
+func maxTarget() *big.Int {
+	target := big.NewInt(1)
+	// left shift
+	target.Lsh(target, uint(256-initialTargetBits))
+	return target
+}
+
+// targetAfterInterval returns the target following the interval of retargetInterval blocks from first to last
+func targetAfterInterval(first, last *Block) *big.Int {
+	actualTimespan := last.Timestamp - first.Timestamp
+	expectedTimespan := int64((retargetInterval - 1) * targetBlockSpacing)
+
+	return retarget(new(big.Int).SetBytes(last.Target), actualTimespan, expectedTimespan)
+}
+
+// retarget scales a target by the ratio between the actual and the expected duration of an interval
+// The ratio is clamped to maxRetargetFactor and the result never gets easier than maxTarget
+func retarget(target *big.Int, actualTimespan, expectedTimespan int64) *big.Int {
+	newTarget := new(big.Int).Mul(target, big.NewInt(actualTimespan))
+	newTarget.Div(newTarget, big.NewInt(expectedTimespan))
+
+	factor := big.NewInt(maxRetargetFactor)
+	minTarget := new(big.Int).Div(target, factor)
+	if newTarget.Cmp(minTarget) < 0 {
+		newTarget = minTarget
+	}
+	if limit := new(big.Int).Mul(target, factor); newTarget.Cmp(limit) > 0 {
+		newTarget = limit
+	}
+	if newTarget.Cmp(maxTarget()) > 0 {
+		newTarget = maxTarget()
+	}
+
+	return newTarget
+}
+
+// blockWork returns the expected number of hashes needed to find a hash below target, 2^256 / (target+1)
+func blockWork(target []byte) *big.Int {
+	denominator := new(big.Int).Add(new(big.Int).SetBytes(target), big.NewInt(1))
+	return new(big.Int).Div(new(big.Int).Lsh(big.NewInt(1), 256), denominator)
+}
+
+// prepareData simply combine a block with target, height and nonce
 func (pow *ProofOfWork) prepareData(nonce int) []byte {
 	data := bytes.Join(
 		[][]byte{
 			pow.block.PrevBlockHash,
-			pow.block.HashTransactions(),
+			pow.txHash,
 			IntToHex(pow.block.Timestamp),
-			IntToHex(int64(targerBits)),
+			pow.block.Target,
+			IntToHex(int64(pow.block.Height)),
 			IntToHex(int64(nonce)),
 		},
 		[]byte{},
@@ -57,7 +117,10 @@ func (pow *ProofOfWork) Run() (int, []byte) {
 		data := pow.prepareData(nonce)
 		// Step2: generate sha-256 hash of data
 		hash = sha256.Sum256(data)
-		fmt.Printf("\r%x", hash)
+		// printing every hash slows mining down a lot, only show some progress
+		if nonce%progressInterval == 0 {
+			fmt.Printf("\r%x", hash)
+		}
 		// Step3: convert the generated hash to a big int
 		hashInt.SetBytes(hash[:])
 		// Step4: compare generated int with target
@@ -67,11 +130,11 @@ func (pow *ProofOfWork) Run() (int, []byte) {
 			nonce++
 		}
 	}
-	fmt.Printf("\n\n")
+	fmt.Printf("\r%x\n\n", hash)
 	return nonce, hash[:]
 }
 
-// Validate validates block's PoW
+// Validate validates block's PoW, the block's hash must be the one its nonce produces
 func (pow *ProofOfWork) Validate() bool {
 	var hashInt big.Int
 
@@ -79,7 +142,7 @@ func (pow *ProofOfWork) Validate() bool {
 	hash := sha256.Sum256(data)
 	hashInt.SetBytes(hash[:])
 
-	isValid := hashInt.Cmp(pow.target) == -1
+	isValid := hashInt.Cmp(pow.target) == -1 && bytes.Compare(hash[:], pow.block.Hash) == 0
 
 	return isValid
 }
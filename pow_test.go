@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestRetarget(t *testing.T) {
+	defer useTestDir(t)()
+
+	target := new(big.Int).Rsh(maxTarget(), 8)
+	expected := int64(100)
+
+	tests := []struct {
+		actual int64
+		want   *big.Int
+	}{
+		{100, target},
+		{50, new(big.Int).Div(target, big.NewInt(2))},
+		{200, new(big.Int).Mul(target, big.NewInt(2))},
+		// clamped to 4x both ways
+		{1, new(big.Int).Div(target, big.NewInt(4))},
+		{10000, new(big.Int).Mul(target, big.NewInt(4))},
+	}
+	for _, test := range tests {
+		got := retarget(target, test.actual, expected)
+		if got.Cmp(test.want) != 0 {
+			t.Errorf("retarget with timespan %d = %x, want %x", test.actual, got, test.want)
+		}
+	}
+
+	// never easier than the genesis target
+	if got := retarget(maxTarget(), 10000, expected); got.Cmp(maxTarget()) != 0 {
+		t.Errorf("retarget above the maximum = %x, want %x", got, maxTarget())
+	}
+}
+
+func TestTargetChangesEveryInterval(t *testing.T) {
+	defer useTestDir(t)()
+
+	address := string(NewWallet().GetAddress())
+	bc, err := CreateBlockchain(address, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.Close()
+
+	var blocks []*Block
+	for i := 1; i < retargetInterval; i++ {
+		blocks = append(blocks, bc.MineBlock([]*Transaction{NewCoinbaseTX(address, "")}))
+	}
+	for _, block := range blocks {
+		if new(big.Int).SetBytes(block.Target).Cmp(maxTarget()) != 0 {
+			t.Fatalf("block %x has target %x before the first retarget", block.Hash, block.Target)
+		}
+	}
+
+	// the interval was mined much faster than expected, so the difficulty goes up as much as allowed
+	block := bc.MineBlock([]*Transaction{NewCoinbaseTX(address, "")})
+	want := new(big.Int).Div(maxTarget(), big.NewInt(maxRetargetFactor))
+	if new(big.Int).SetBytes(block.Target).Cmp(want) != 0 {
+		t.Errorf("target at height %d = %x, want %x", retargetInterval, block.Target, want)
+	}
+
+	// a block mined with the old target is rejected
+	easy := NewBlock([]*Transaction{NewCoinbaseTX(address, "")}, block.PrevBlockHash, block.Height, maxTarget())
+	if err := bc.AddBlock(easy); !errors.Is(err, ErrInvalidBlock) {
+		t.Errorf("block with a wrong target: got %v, want %v", err, ErrInvalidBlock)
+	}
+}
+
+func TestBlockTimestampInTheFuture(t *testing.T) {
+	defer useTestDir(t)()
+
+	address := string(NewWallet().GetAddress())
+	bc, err := CreateBlockchain(address, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.Close()
+
+	// a timestamp far ahead would make the interval look slow and the next target easier
+	future := time.Now().Unix() + maxFutureBlockTime + 60
+	block := newBlockAt(future, []*Transaction{NewCoinbaseTX(address, "")}, bc.tip, 1, bc.nextTarget(bc.tip))
+	if err := bc.AddBlock(block); !errors.Is(err, ErrInvalidBlock) {
+		t.Errorf("block from the future: got %v, want %v", err, ErrInvalidBlock)
+	}
+
+	appendBlock(t, bc, block)
+	var invalid *ChainValidationError
+	if _, err := bc.Validate(true); !errors.As(err, &invalid) || invalid.Height != 1 {
+		t.Errorf("Validate = %v, want block 1 invalid", err)
+	}
+}
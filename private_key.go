@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"errors"
+	"math/big"
+)
+
+// privateKeyVersion prefixes exported private keys, so they can't be mistaken for addresses
+const privateKeyVersion = byte(0x80)
+
+// ErrInvalidPrivateKey is returned when an exported private key can't be decoded
+var ErrInvalidPrivateKey = errors.New("Private key is not valid")
+
+// EncodePrivateKey exports the private key of a wallet: the version, the private scalar and a checksum, in Base58
+func EncodePrivateKey(wallet *Wallet) []byte {
+	payload := make([]byte, 1+32)
+	payload[0] = privateKeyVersion
+	wallet.PrivateKey.D.FillBytes(payload[1:])
+
+	return Base58Encode(append(payload, checksum(payload)...))
+}
+
+// DecodePrivateKey rebuilds the wallet of a private key exported by EncodePrivateKey
+func DecodePrivateKey(encoded string) (*Wallet, error) {
+	for i := 0; i < len(encoded); i++ {
+		if bytes.IndexByte(b58Alphabet, encoded[i]) < 0 {
+			return nil, ErrInvalidPrivateKey
+		}
+	}
+	decoded := Base58Decode([]byte(encoded))
+	if len(decoded) != 1+32+addressCheckSumLen || decoded[0] != privateKeyVersion {
+		return nil, ErrInvalidPrivateKey
+	}
+	payload := decoded[:1+32]
+	if !bytes.Equal(checksum(payload), decoded[1+32:]) {
+		return nil, ErrInvalidPrivateKey
+	}
+
+	d := new(big.Int).SetBytes(payload[1:])
+	if d.Sign() == 0 || d.Cmp(elliptic.P256().Params().N) >= 0 {
+		return nil, ErrInvalidPrivateKey
+	}
+	private := privateKeyFromD(d)
+	return &Wallet{private, pubKeyBytes(private.PublicKey)}, nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestPrivateKeyEncoding(t *testing.T) {
+	wallet := NewWallet()
+	encoded := EncodePrivateKey(wallet)
+
+	decoded, err := DecodePrivateKey(string(encoded))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.PrivateKey.D.Cmp(wallet.PrivateKey.D) != 0 || !bytes.Equal(decoded.GetAddress(), wallet.GetAddress()) {
+		t.Error("the decoded key isn't the encoded one")
+	}
+
+	// a typo breaks the checksum, and an address isn't a private key
+	typo := []byte(string(encoded))
+	if typo[10] == '2' {
+		typo[10] = '3'
+	} else {
+		typo[10] = '2'
+	}
+	for _, invalid := range []string{string(typo), string(wallet.GetAddress()), "0OIl"} {
+		if _, err := DecodePrivateKey(invalid); !errors.Is(err, ErrInvalidPrivateKey) {
+			t.Errorf("DecodePrivateKey(%s): got %v, want %v", invalid, err, ErrInvalidPrivateKey)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+)
+
+// ErrIncompleteTransaction is returned when a raw transaction still has unsigned inputs
+var ErrIncompleteTransaction = errors.New("Transaction is not fully signed")
+
+// ErrNoInputs is returned for a raw transaction spending nothing
+var ErrNoInputs = errors.New("Transaction has no inputs")
+
+// RawTransaction is a transaction on its way from the node building it to the machine holding its keys and back
+// PrevOutputs are the outputs its inputs spend, in the same order, so it can be signed without the blockchain
+// Genesis is the hash of the genesis block of the chain it is built for, which the signatures commit to
+type RawTransaction struct {
+	Tx          Transaction
+	PrevOutputs []SpentOutput
+	Genesis     []byte
+}
+
+// NewRawTransaction builds an unsigned transaction paying every payment from the outputs of address from
+// Only the address is needed, the public key is set by whoever signs the inputs
+func NewRawTransaction(from string, payments []Payment, fee int, selector CoinSelector, UTXOSet *UTXOSet) (*RawTransaction, error) {
+	if !ValidateAddress(from) {
+		return nil, fmt.Errorf("Address is not valid: %s", from)
+	}
+	if addressVersion, _ := decodeAddress(from); addressVersion == multisigVersion {
+		return nil, fmt.Errorf("Spending from the multisig address %s needs its policy", from)
+	}
+	return newRawTransaction(from, payments, fee, selector, UTXOSet)
+}
+
+// NewMultisigRawTransaction builds an unsigned transaction paying every payment from the outputs of the address
+// of policy. The inputs hold the policy, and a slot for the signature of each of its keys
+func NewMultisigRawTransaction(policy *Multisig, payments []Payment, fee int, selector CoinSelector, UTXOSet *UTXOSet) (*RawTransaction, error) {
+	err := policy.check()
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := newRawTransaction(string(policy.Address()), payments, fee, selector, UTXOSet)
+	if err != nil {
+		return nil, err
+	}
+	for i := range raw.Tx.Vin {
+		raw.Tx.Vin[i].Multisig = policy
+		raw.Tx.Vin[i].Signatures = make([][]byte, len(policy.PubKeys))
+	}
+	return raw, nil
+}
+
+func newRawTransaction(from string, payments []Payment, fee int, selector CoinSelector, UTXOSet *UTXOSet) (*RawTransaction, error) {
+	outputs, err := paymentOutputs(payments)
+	if err != nil {
+		return nil, err
+	}
+	tx, selected, err := newUnsignedTransaction(from, outputs, fee, selector, UTXOSet)
+	if err != nil {
+		return nil, err
+	}
+
+	lock := NewTxOutput(0, from)
+	raw := RawTransaction{Tx: *tx, Genesis: UTXOSet.Blockchain.GenesisHash()}
+	for _, out := range selected {
+		raw.PrevOutputs = append(raw.PrevOutputs, SpentOutput{out.TxID, out.Vout, TxOutput{out.Value, lock.PubKeyHash, lock.Multisig, nil}})
+	}
+	return &raw, nil
+}
+
+// Sign signs the inputs spending outputs locked with the key of wallet, or with a multisig policy including it,
+// and returns how many it signed
+func (r *RawTransaction) Sign(wallet *Wallet) (int, error) {
+	prevOuts, err := r.spentOutputs()
+	if err != nil {
+		return 0, err
+	}
+
+	pubKeyHash := HashPubKey(wallet.PublicKey)
+	signed := 0
+	for inID, prevOut := range r.PrevOutputs {
+		vin := &r.Tx.Vin[inID]
+		if prevOut.Output.Multisig {
+			if vin.Multisig == nil || !vin.UsesKey(prevOut.Output.PubKeyHash) {
+				return signed, fmt.Errorf("Input %d has no multisig policy matching the output it spends", inID)
+			}
+			key := vin.Multisig.KeyIndex(wallet.PublicKey)
+			if key < 0 {
+				continue
+			}
+			if len(vin.Signatures) != len(vin.Multisig.PubKeys) {
+				vin.Signatures = make([][]byte, len(vin.Multisig.PubKeys))
+			}
+			vin.Signatures[key] = signHash(wallet.PrivateKey, r.Tx.sigHash(inID, prevOut.Output, r.Genesis))
+			signed++
+			continue
+		}
+
+		if !prevOut.Output.IsLockedWithKey(pubKeyHash) {
+			continue
+		}
+		vin.PubKey = wallet.PublicKey
+		r.Tx.signInput(inID, wallet.PrivateKey, prevOuts[inID], r.Genesis)
+		signed++
+	}
+
+	if r.IsComplete() {
+		r.Tx.finalize()
+	}
+	return signed, nil
+}
+
+// IsComplete tells whether every input is signed, by enough keys for multisig inputs
+func (r *RawTransaction) IsComplete() bool {
+	for _, vin := range r.Tx.Vin {
+		if vin.Multisig != nil {
+			if missingSignatures(vin) > 0 {
+				return false
+			}
+		} else if vin.Signature == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// missingSignatures returns how many more keys of its policy must sign a multisig input
+func missingSignatures(vin TxInput) int {
+	missing := vin.Multisig.Required
+	for _, signature := range vin.Signatures {
+		if signature != nil {
+			missing--
+		}
+	}
+	if missing < 0 {
+		return 0
+	}
+	return missing
+}
+
+// Fee returns what the transaction leaves to the miner, according to its previous outputs
+func (r *RawTransaction) Fee() (int, error) {
+	prevOuts, err := r.spentOutputs()
+	if err != nil {
+		return 0, err
+	}
+	return spentOutputsFee(&r.Tx, prevOuts)
+}
+
+// Verify checks the signatures of a complete transaction against its previous outputs
+// The previous outputs come with the transaction, the blockchain checks they really are unspent, and the time
+// locks of their scripts, when it is sent
+func (r *RawTransaction) Verify() error {
+	if !r.IsComplete() {
+		return ErrIncompleteTransaction
+	}
+	prevOuts, err := r.spentOutputs()
+	if err != nil {
+		return err
+	}
+	if !r.Tx.verifyInputs(prevOuts, math.MaxInt32, r.Genesis) {
+		return errors.New("Transaction signatures are not valid")
+	}
+	if !bytes.Equal(r.Tx.ID, r.Tx.Hash()) {
+		return errors.New("Transaction ID doesn't match its content")
+	}
+	return nil
+}
+
+// spentOutputs checks the previous outputs are those the inputs spend, in the same order, and returns them
+func (r *RawTransaction) spentOutputs() ([]TxOutput, error) {
+	if len(r.Tx.Vin) == 0 {
+		return nil, ErrNoInputs
+	}
+	if len(r.PrevOutputs) != len(r.Tx.Vin) {
+		return nil, fmt.Errorf("Transaction has %d inputs but %d previous outputs", len(r.Tx.Vin), len(r.PrevOutputs))
+	}
+
+	var prevOuts []TxOutput
+	for inID, prevOut := range r.PrevOutputs {
+		vin := r.Tx.Vin[inID]
+		if !bytes.Equal(vin.Txid, prevOut.Txid) || vin.Vout != prevOut.Vout {
+			return nil, fmt.Errorf("Previous output %d is not the one input %d spends", inID, inID)
+		}
+		prevOuts = append(prevOuts, prevOut.Output)
+	}
+	return prevOuts, nil
+}
+
+// SaveToFile writes the raw transaction as JSON
+func (r *RawTransaction) SaveToFile(file string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, append(data, '\n'), 0644)
+}
+
+// LoadRawTransaction reads a raw transaction written by SaveToFile
+func LoadRawTransaction(file string) (*RawTransaction, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var r RawTransaction
+	err = json.Unmarshal(data, &r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return &r, nil
+}
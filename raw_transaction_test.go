@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestOfflineSigning(t *testing.T) {
+	defer useTestDir(t)()
+
+	alice := NewWallet()
+	bob := NewWallet()
+	bc, err := CreateBlockchain(string(alice.GetAddress()), "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.Close()
+	bc.MineBlock([]*Transaction{NewRewardTX(string(alice.GetAddress()), "", subsidy)})
+
+	// the online node only knows the address of alice
+	UTXOSet := UTXOSet{bc}
+	raw, err := NewRawTransaction(string(alice.GetAddress()), []Payment{{string(bob.GetAddress()), 15}}, 1, nil, &UTXOSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(raw.Tx.Vin) != 2 || raw.IsComplete() {
+		t.Fatalf("unsigned transaction has %d inputs, complete: %v", len(raw.Tx.Vin), raw.IsComplete())
+	}
+	err = raw.SaveToFile("unsigned.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the offline machine signs from the file, a key of no input signs nothing
+	raw, err = LoadRawTransaction("unsigned.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signed, err := raw.Sign(bob); err != nil || signed != 0 {
+		t.Errorf("signing with an unrelated key: %d inputs, %v", signed, err)
+	}
+	if err := raw.Verify(); !errors.Is(err, ErrIncompleteTransaction) {
+		t.Errorf("verifying an unsigned transaction: got %v, want %v", err, ErrIncompleteTransaction)
+	}
+	if signed, err := raw.Sign(alice); err != nil || signed != 2 {
+		t.Fatalf("signing with the key of the inputs: %d inputs, %v", signed, err)
+	}
+	err = raw.SaveToFile("signed.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err = LoadRawTransaction("signed.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = raw.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fee, err := raw.Fee(); err != nil || fee != 1 {
+		t.Errorf("fee = %d, %v, want 1", fee, err)
+	}
+	if !bc.VerifyTransaction(&raw.Tx) {
+		t.Error("the blockchain rejects the signed transaction")
+	}
+
+	// the signatures cover the outputs
+	raw.Tx.Vout[0].Value++
+	if err := raw.Verify(); err == nil {
+		t.Error("a transaction changed after it was signed passes verification")
+	}
+}
+
+func TestRawTransactionWithoutInputs(t *testing.T) {
+	bob := NewWallet()
+	raw := &RawTransaction{Tx: Transaction{Vout: []TxOutput{*NewTxOutput(10, string(bob.GetAddress()))}}}
+	raw.Tx.ID = raw.Tx.Hash()
+
+	if err := raw.Verify(); !errors.Is(err, ErrNoInputs) {
+		t.Errorf("verifying a transaction without inputs: got %v, want %v", err, ErrNoInputs)
+	}
+	if _, err := raw.Fee(); !errors.Is(err, ErrNoInputs) {
+		t.Errorf("fee of a transaction without inputs: got %v, want %v", err, ErrNoInputs)
+	}
+	if _, err := raw.Sign(bob); !errors.Is(err, ErrNoInputs) {
+		t.Errorf("signing a transaction without inputs: got %v, want %v", err, ErrNoInputs)
+	}
+}
+
+func TestRawTransactionSignsSpentValues(t *testing.T) {
+	defer useTestDir(t)()
+
+	alice := NewWallet()
+	bob := NewWallet()
+	bc, err := CreateBlockchain(string(alice.GetAddress()), "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.Close()
+
+	UTXOSet := UTXOSet{bc}
+	raw, err := NewRawTransaction(string(alice.GetAddress()), []Payment{{string(bob.GetAddress()), 5}}, 1, nil, &UTXOSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a compromised online node understates the spent output, so the signer sees a fee of 1 and no change
+	raw.Tx.Vout = raw.Tx.Vout[:1]
+	raw.PrevOutputs[0].Output.Value = 6
+	if fee, err := raw.Fee(); err != nil || fee != 1 {
+		t.Fatalf("fee shown to the signer = %d, %v, want 1", fee, err)
+	}
+	if signed, err := raw.Sign(alice); err != nil || signed != 1 {
+		t.Fatalf("signing: %d inputs, %v", signed, err)
+	}
+	if bc.VerifyTransaction(&raw.Tx) {
+		t.Error("the blockchain accepts a signature made over an understated value")
+	}
+
+	// once signed, the previous outputs can't be changed either
+	raw.PrevOutputs[0].Output.Value = subsidy
+	if err := raw.Verify(); err == nil {
+		t.Error("a signed transaction passes verification with a changed previous output value")
+	}
+}
+
+func TestRawTransactionSpendingFarOutputs(t *testing.T) {
+	alice := NewWallet()
+	bob := NewWallet()
+
+	// the outputs are not looked up by their index, an index as large as this must not be allocated for
+	txID := []byte{1}
+	vout := math.MaxInt32
+	raw := &RawTransaction{
+		Tx:          Transaction{nil, []TxInput{{txID, vout, nil, nil, nil, nil, nil, 0}}, []TxOutput{*NewTxOutput(9, string(bob.GetAddress()))}, 0},
+		PrevOutputs: []SpentOutput{{txID, vout, *NewTxOutput(10, string(alice.GetAddress()))}},
+	}
+	if n, err := raw.Sign(alice); err != nil || n != 1 {
+		t.Fatalf("signed %d inputs, %v", n, err)
+	}
+	if err := raw.Verify(); err != nil {
+		t.Error(err)
+	}
+	if fee, err := raw.Fee(); err != nil || fee != 1 {
+		t.Errorf("fee is %d, %v, want 1", fee, err)
+	}
+
+	raw.PrevOutputs[0].Vout = vout - 1
+	if err := raw.Verify(); err == nil {
+		t.Error("a previous output other than the one the input spends is accepted")
+	}
+}
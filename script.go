@@ -0,0 +1,415 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// opcodes of the script language, they have the values of the Bitcoin opcodes doing the same where there is one
+// Bytes 0x01 to 0x4b push the next that many bytes
+const (
+	opFalse         = byte(0x00) // pushes an empty item, which is false
+	opPushData1     = byte(0x4c) // pushes the data of length given by the next byte
+	opPushData2     = byte(0x4d) // pushes the data of length given by the next 2 bytes, little-endian
+	opIf            = byte(0x63) // pops an item, runs the operations up to ELSE or ENDIF only if it is true
+	opElse          = byte(0x67) // runs the operations up to ENDIF only if those since IF didn't run
+	opEndIf         = byte(0x68) // ends an IF
+	opDup           = byte(0x76) // duplicates the top item
+	opEqualVerify   = byte(0x88) // fails unless the two top items are equal, and pops them
+	opHash160       = byte(0xa9) // replaces the top item with its hash, as HashPubKey
+	opCheckSig      = byte(0xac) // pops a public key and a signature, pushes whether the signature is valid
+	opCheckMultisig = byte(0xae) // pops a serialized multisig policy and a signature slot per key, pushes whether they satisfy it
+	opTimeLock      = byte(0xb1) // pops a height, fails if the transaction is in a block below it
+	opHashLock      = byte(0xc0) // pops a SHA-256 hash and a preimage, fails unless the preimage hashes to it
+)
+
+// maxScriptIntLen bounds the size of the numbers scripts push, as little-endian unsigned integers
+const maxScriptIntLen = 8
+
+var opNames = map[byte]string{
+	opIf:            "IF",
+	opElse:          "ELSE",
+	opEndIf:         "ENDIF",
+	opDup:           "DUP",
+	opEqualVerify:   "EQUALVERIFY",
+	opHash160:       "HASH160",
+	opCheckSig:      "CHECKSIG",
+	opCheckMultisig: "CHECKMULTISIG",
+	opTimeLock:      "TIMELOCK",
+	opHashLock:      "HASHLOCK",
+}
+
+// ErrScriptFailed is returned when an unlocking script doesn't satisfy the locking script of the output it spends
+var ErrScriptFailed = errors.New("Script failed")
+
+// Script is a program of the script language: opcodes, and data they push on a stack
+// Outputs are locked with a script, and the inputs spending them hold a script pushing what it needs, such as
+// signatures. An input is valid when the locking script, run after its unlocking script on the same stack,
+// leaves true as the only item
+type Script []byte
+
+// AddOp appends an opcode to the script
+func (s Script) AddOp(op byte) Script {
+	return append(s, op)
+}
+
+// Add appends the operations of other
+func (s Script) Add(other Script) Script {
+	return append(s, other...)
+}
+
+// maxScriptPush is the most bytes one operation can push, the length of OP_PUSHDATA2 being 2 bytes
+const maxScriptPush = 0xffff
+
+// checkPushes returns an error if one of data is too long for AddData to push it
+// Data coming from transactions is checked with it first, so a peer can't make AddData panic
+func checkPushes(data ...[]byte) error {
+	for _, d := range data {
+		if len(d) > maxScriptPush {
+			return fmt.Errorf("%w: push of %d bytes is longer than %d", ErrScriptFailed, len(d), maxScriptPush)
+		}
+	}
+	return nil
+}
+
+// AddData appends an operation pushing data, which can't be longer than maxScriptPush
+// Untrusted data is checked with checkPushes before, AddData panics on data too long
+func (s Script) AddData(data []byte) Script {
+	switch {
+	case len(data) > maxScriptPush:
+		log.Panicf("ERROR: Script push of %d bytes is longer than %d", len(data), maxScriptPush)
+	case len(data) == 0:
+		return append(s, opFalse)
+	case len(data) < int(opPushData1):
+		s = append(s, byte(len(data)))
+	case len(data) <= 0xff:
+		s = append(s, opPushData1, byte(len(data)))
+	default:
+		s = append(s, opPushData2)
+		s = binary.LittleEndian.AppendUint16(s, uint16(len(data)))
+	}
+	return append(s, data...)
+}
+
+// AddInt appends an operation pushing a non-negative number
+func (s Script) AddInt(n int) Script {
+	return s.AddData(scriptInt(n))
+}
+
+// String disassembles the script, pushed data is hex encoded
+func (s Script) String() string {
+	ops, err := s.parse()
+	if err != nil {
+		return fmt.Sprintf("[invalid script %x]", []byte(s))
+	}
+
+	var words []string
+	for _, op := range ops {
+		if op.data != nil {
+			words = append(words, hex.EncodeToString(op.data))
+		} else if name, ok := opNames[op.op]; ok {
+			words = append(words, name)
+		} else {
+			words = append(words, fmt.Sprintf("UNKNOWN_%02x", op.op))
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// scriptOp is an operation of a script, data is set for the operations pushing data, even empty
+type scriptOp struct {
+	op   byte
+	data []byte
+}
+
+// parse splits the script into its operations
+func (s Script) parse() ([]scriptOp, error) {
+	var ops []scriptOp
+	for i := 0; i < len(s); {
+		op := s[i]
+		i++
+
+		var size int
+		switch {
+		case op == opFalse:
+			ops = append(ops, scriptOp{op, []byte{}})
+			continue
+		case op < opPushData1:
+			size = int(op)
+		case op == opPushData1:
+			if i+1 > len(s) {
+				return nil, fmt.Errorf("%w: truncated push", ErrScriptFailed)
+			}
+			size = int(s[i])
+			i++
+		case op == opPushData2:
+			if i+2 > len(s) {
+				return nil, fmt.Errorf("%w: truncated push", ErrScriptFailed)
+			}
+			size = int(binary.LittleEndian.Uint16(s[i:]))
+			i += 2
+		default:
+			ops = append(ops, scriptOp{op, nil})
+			continue
+		}
+
+		if i+size > len(s) {
+			return nil, fmt.Errorf("%w: truncated push", ErrScriptFailed)
+		}
+		ops = append(ops, scriptOp{op, s[i : i+size]})
+		i += size
+	}
+	return ops, nil
+}
+
+// scriptContext is what the opcodes need to know about the transaction whose input runs the scripts
+type scriptContext struct {
+	hash   []byte // what the signatures of the input sign
+	height int    // height of the block the transaction is in
+}
+
+// runScripts checks that the unlocking script of an input satisfies the locking script of the output it spends
+// The unlocking script may only push data, so that it can't skip the checks of the locking script
+func runScripts(unlocking, locking Script, ctx scriptContext) error {
+	ops, err := unlocking.parse()
+	if err != nil {
+		return err
+	}
+	var stack [][]byte
+	for _, op := range ops {
+		if op.data == nil {
+			return fmt.Errorf("%w: unlocking script runs %s", ErrScriptFailed, Script{op.op})
+		}
+		stack = append(stack, op.data)
+	}
+
+	stack, err = locking.run(stack, ctx)
+	if err != nil {
+		return err
+	}
+	if len(stack) != 1 || !scriptBool(stack[0]) {
+		return fmt.Errorf("%w: script doesn't end with true alone on the stack", ErrScriptFailed)
+	}
+	return nil
+}
+
+// run executes the script on stack and returns the stack it leaves
+func (s Script) run(stack [][]byte, ctx scriptContext) ([][]byte, error) {
+	ops, err := s.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	pop := func() ([]byte, error) {
+		if len(stack) == 0 {
+			return nil, fmt.Errorf("%w: empty stack", ErrScriptFailed)
+		}
+		item := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		return item, nil
+	}
+
+	// conditions holds the branches of the IFs being run, the operations only run when they are all true
+	var conditions []bool
+	executing := func() bool {
+		for _, condition := range conditions {
+			if !condition {
+				return false
+			}
+		}
+		return true
+	}
+
+	for _, op := range ops {
+		isBranch := op.data == nil && (op.op == opIf || op.op == opElse || op.op == opEndIf)
+		if !isBranch && !executing() {
+			continue
+		}
+		if op.data != nil {
+			stack = append(stack, op.data)
+			continue
+		}
+
+		switch op.op {
+		case opIf:
+			// in a branch that doesn't run, the IF doesn't pop and none of its branches run
+			condition := false
+			if executing() {
+				item, err := pop()
+				if err != nil {
+					return nil, err
+				}
+				condition = scriptBool(item)
+			}
+			conditions = append(conditions, condition)
+
+		case opElse:
+			if len(conditions) == 0 {
+				return nil, fmt.Errorf("%w: ELSE without IF", ErrScriptFailed)
+			}
+			conditions[len(conditions)-1] = !conditions[len(conditions)-1]
+
+		case opEndIf:
+			if len(conditions) == 0 {
+				return nil, fmt.Errorf("%w: ENDIF without IF", ErrScriptFailed)
+			}
+			conditions = conditions[:len(conditions)-1]
+
+		case opDup:
+			item, err := pop()
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, item, item)
+
+		case opHash160:
+			item, err := pop()
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, HashPubKey(item))
+
+		case opEqualVerify:
+			a, err := pop()
+			if err != nil {
+				return nil, err
+			}
+			b, err := pop()
+			if err != nil {
+				return nil, err
+			}
+			if !bytes.Equal(a, b) {
+				return nil, fmt.Errorf("%w: EQUALVERIFY", ErrScriptFailed)
+			}
+
+		case opCheckSig:
+			pubKey, err := pop()
+			if err != nil {
+				return nil, err
+			}
+			signature, err := pop()
+			if err != nil {
+				return nil, err
+			}
+			valid := len(pubKey) == 64 && len(signature) == 64 && verifyHash(pubKey, ctx.hash, signature)
+			stack = append(stack, scriptBoolBytes(valid))
+
+		case opCheckMultisig:
+			data, err := pop()
+			if err != nil {
+				return nil, err
+			}
+			policy, err := DeserializeMultisig(data)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrScriptFailed, err)
+			}
+			// the slot of the first key is the deepest, empty slots are keys that didn't sign
+			signatures := make([][]byte, len(policy.PubKeys))
+			for i := len(signatures) - 1; i >= 0; i-- {
+				signature, err := pop()
+				if err != nil {
+					return nil, err
+				}
+				if len(signature) > 0 {
+					signatures[i] = signature
+				}
+			}
+			stack = append(stack, scriptBoolBytes(policy.verify(ctx.hash, signatures)))
+
+		case opHashLock:
+			hash, err := pop()
+			if err != nil {
+				return nil, err
+			}
+			preimage, err := pop()
+			if err != nil {
+				return nil, err
+			}
+			preimageHash := sha256.Sum256(preimage)
+			if !bytes.Equal(preimageHash[:], hash) {
+				return nil, fmt.Errorf("%w: HASHLOCK", ErrScriptFailed)
+			}
+
+		case opTimeLock:
+			item, err := pop()
+			if err != nil {
+				return nil, err
+			}
+			height, err := decodeScriptInt(item)
+			if err != nil {
+				return nil, err
+			}
+			if ctx.height < height {
+				return nil, fmt.Errorf("%w: TIMELOCK until height %d, the transaction is at height %d", ErrScriptFailed, height, ctx.height)
+			}
+
+		default:
+			return nil, fmt.Errorf("%w: unknown opcode %02x", ErrScriptFailed, op.op)
+		}
+	}
+	if len(conditions) != 0 {
+		return nil, fmt.Errorf("%w: IF without ENDIF", ErrScriptFailed)
+	}
+	return stack, nil
+}
+
+// scriptBool tells whether an item is true: it has a byte other than 0
+func scriptBool(item []byte) bool {
+	for _, b := range item {
+		if b != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// scriptBoolBytes returns the item opcodes push for b
+func scriptBoolBytes(b bool) []byte {
+	if b {
+		return []byte{1}
+	}
+	return []byte{}
+}
+
+// scriptInt encodes a non-negative number as the shortest little-endian bytes, 0 being empty
+func scriptInt(n int) []byte {
+	if n < 0 {
+		log.Panicf("ERROR: Script number %d is negative", n)
+	}
+	var data []byte
+	for v := uint64(n); v > 0; v >>= 8 {
+		data = append(data, byte(v))
+	}
+	return data
+}
+
+// decodeScriptInt decodes a number encoded by scriptInt
+func decodeScriptInt(data []byte) (int, error) {
+	if len(data) > maxScriptIntLen || len(data) > 0 && data[len(data)-1] == 0 {
+		return 0, fmt.Errorf("%w: %x is not a number", ErrScriptFailed, data)
+	}
+	var v uint64
+	for i := len(data) - 1; i >= 0; i-- {
+		v = v<<8 | uint64(data[i])
+	}
+	if int(v) < 0 {
+		return 0, fmt.Errorf("%w: %x is not a number", ErrScriptFailed, data)
+	}
+	return int(v), nil
+}
+
+// payToPubKeyHashScript returns the script locking an output with the hash of a public key, the standard output
+func payToPubKeyHashScript(pubKeyHash []byte) Script {
+	return Script{}.AddOp(opDup).AddOp(opHash160).AddData(pubKeyHash).AddOp(opEqualVerify).AddOp(opCheckSig)
+}
+
+// payToMultisigScript returns the script locking an output with the hash of a multisig policy
+func payToMultisigScript(policyHash []byte) Script {
+	return Script{}.AddOp(opDup).AddOp(opHash160).AddData(policyHash).AddOp(opEqualVerify).AddOp(opCheckMultisig)
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"crypto/sha256"
+	"errors"
+	"testing"
+)
+
+func TestScripts(t *testing.T) {
+	alice, bob := NewWallet(), NewWallet()
+	hash := sha256.Sum256([]byte("spending transaction"))
+	ctx := scriptContext{hash[:], 10}
+	aliceSig := signHash(alice.PrivateKey, hash[:])
+	bobSig := signHash(bob.PrivateKey, hash[:])
+
+	secret := []byte("secret")
+	secretHash := sha256.Sum256(secret)
+	policy, err := NewMultisig(2, [][]byte{alice.PublicKey, bob.PublicKey, NewWallet().PublicKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payToAlice := payToPubKeyHashScript(HashPubKey(alice.PublicKey))
+	hashLocked := Script{}.AddData(secretHash[:]).AddOp(opHashLock).AddData(alice.PublicKey).AddOp(opCheckSig)
+	timeLocked := Script{}.AddInt(10).AddOp(opTimeLock).Add(payToAlice)
+	laterTimeLocked := Script{}.AddInt(11).AddOp(opTimeLock).Add(payToAlice)
+	bareMultisig := Script{}.AddData(policy.Serialize()).AddOp(opCheckMultisig)
+	branches := Script{}.AddOp(opIf).AddData(secretHash[:]).AddOp(opHashLock).AddOp(opElse).AddInt(11).AddOp(opTimeLock).AddOp(opEndIf).AddData(alice.PublicKey).AddOp(opCheckSig)
+	unbalanced := Script{}.AddOp(opIf).AddData(alice.PublicKey).AddOp(opCheckSig)
+
+	tests := []struct {
+		name      string
+		unlocking Script
+		locking   Script
+		valid     bool
+	}{
+		{"key", Script{}.AddData(aliceSig).AddData(alice.PublicKey), payToAlice, true},
+		{"other key", Script{}.AddData(bobSig).AddData(bob.PublicKey), payToAlice, false},
+		{"signature of another key", Script{}.AddData(bobSig).AddData(alice.PublicKey), payToAlice, false},
+		{"extra item", Script{}.AddData(secret).AddData(aliceSig).AddData(alice.PublicKey), payToAlice, false},
+		{"empty", nil, payToAlice, false},
+		{"preimage", Script{}.AddData(aliceSig).AddData(secret), hashLocked, true},
+		{"wrong preimage", Script{}.AddData(aliceSig).AddData([]byte("guess")), hashLocked, false},
+		{"height reached", Script{}.AddData(aliceSig).AddData(alice.PublicKey), timeLocked, true},
+		{"height not reached", Script{}.AddData(aliceSig).AddData(alice.PublicKey), laterTimeLocked, false},
+		{"2 of 3", Script{}.AddData(aliceSig).AddData(bobSig).AddData(nil), bareMultisig, true},
+		{"1 of 3", Script{}.AddData(aliceSig).AddData(nil).AddData(nil), bareMultisig, false},
+		{"signatures in the wrong slots", Script{}.AddData(bobSig).AddData(aliceSig).AddData(nil), bareMultisig, false},
+		{"standard multisig", Script{}.AddData(aliceSig).AddData(bobSig).AddData(nil).AddData(policy.Serialize()), payToMultisigScript(policy.Hash()), true},
+		{"if branch", Script{}.AddData(aliceSig).AddData(secret).AddData([]byte{1}), branches, true},
+		{"else branch before its height", Script{}.AddData(aliceSig).AddData(nil), branches, false},
+		{"if branch with the wrong preimage", Script{}.AddData(aliceSig).AddData([]byte("guess")).AddData([]byte{1}), branches, false},
+		{"if without endif", Script{}.AddData(aliceSig).AddData([]byte{1}), unbalanced, false},
+		{"opcode in unlocking script", Script{}.AddData(aliceSig).AddData(alice.PublicKey).AddOp(opDup).AddOp(opEqualVerify), payToAlice, false},
+		{"unknown opcode", Script{}.AddData(aliceSig).AddData(alice.PublicKey), Script{0xff}.Add(payToAlice), false},
+	}
+	for _, test := range tests {
+		err := runScripts(test.unlocking, test.locking, ctx)
+		if test.valid && err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		}
+		if !test.valid && !errors.Is(err, ErrScriptFailed) {
+			t.Errorf("%s: got %v, want %v", test.name, err, ErrScriptFailed)
+		}
+	}
+}
+
+func TestScriptPushes(t *testing.T) {
+	for _, size := range []int{0, 1, 75, 76, 255, 256, 1026} {
+		data := make([]byte, size)
+		ops, err := Script{}.AddData(data).AddInt(size).parse()
+		if err != nil {
+			t.Fatalf("push of %d bytes: %v", size, err)
+		}
+		if len(ops) != 2 || len(ops[0].data) != size {
+			t.Fatalf("push of %d bytes parsed as %v", size, ops)
+		}
+		if n, err := decodeScriptInt(ops[1].data); err != nil || n != size {
+			t.Errorf("number %d decoded as %d, %v", size, n, err)
+		}
+	}
+
+	for _, build := range []func() Script{
+		func() Script { return Script{}.AddData(make([]byte, maxScriptPush+1)) },
+		func() Script { return Script{}.AddInt(-1) },
+	} {
+		if script, ok := panics(build); !ok {
+			t.Errorf("invalid push built as %v", script)
+		}
+	}
+	if ops, err := (Script{}).AddData(make([]byte, maxScriptPush)).parse(); err != nil || len(ops[0].data) != maxScriptPush {
+		t.Errorf("push of %d bytes: %v", maxScriptPush, err)
+	}
+
+	if _, err := (Script{opPushData1, 2, 1}).parse(); !errors.Is(err, ErrScriptFailed) {
+		t.Errorf("truncated push: got %v, want %v", err, ErrScriptFailed)
+	}
+	if got, want := payToPubKeyHashScript([]byte{0xab, 0xcd}).String(), "DUP HASH160 abcd EQUALVERIFY CHECKSIG"; got != want {
+		t.Errorf("disassembly = %q, want %q", got, want)
+	}
+}
+
+func TestSpendScriptOutput(t *testing.T) {
+	defer useTestDir(t)()
+
+	alice := NewWallet()
+	bc, err := CreateBlockchain(string(alice.GetAddress()), "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.Close()
+
+	// anyone knowing the secret can spend the output
+	secret := []byte("secret")
+	secretHash := sha256.Sum256(secret)
+	UTXOSet := UTXOSet{bc}
+	tx, _, err := newUnsignedTransaction(string(alice.GetAddress()), []TxOutput{*NewScriptOutput(subsidy, Script{}.AddData(secretHash[:]).AddOp(opHashLock).AddData([]byte{1}))}, 0, nil, &UTXOSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.Vin[0].PubKey = alice.PublicKey
+	bc.SignTransaction(tx, alice.PrivateKey)
+	tx.ID = tx.Hash()
+	if !bc.VerifyTransaction(tx) {
+		t.Fatal("the blockchain rejects a payment to a script")
+	}
+	bc.MineBlock([]*Transaction{NewCoinbaseTX(string(alice.GetAddress()), ""), tx})
+
+	spend := Transaction{nil, []TxInput{{Txid: tx.ID, Vout: 0}}, []TxOutput{*NewTxOutput(subsidy, string(alice.GetAddress()))}, 0}
+	spend.Vin[0].Script = Script{}.AddData([]byte("guess"))
+	spend.ID = spend.Hash()
+	if bc.VerifyTransaction(&spend) {
+		t.Error("the blockchain accepts a wrong preimage")
+	}
+	spend.Vin[0].Script = Script{}.AddData(secret)
+	spend.ID = spend.Hash()
+	if !bc.VerifyTransaction(&spend) {
+		t.Error("the blockchain rejects the preimage")
+	}
+}
+
+// panics runs build and tells whether it panicked
+func panics(build func() Script) (script Script, ok bool) {
+	defer func() {
+		if recover() != nil {
+			ok = true
+		}
+	}()
+	return build(), false
+}
+
+func TestVerifyRejectsOversizedPushes(t *testing.T) {
+	defer useTestDir(t)()
+
+	alice := NewWallet()
+	bc, err := CreateBlockchain(string(alice.GetAddress()), "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.Close()
+
+	genesis, err := bc.GetBlock(bc.tip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy, err := NewMultisig(1, [][]byte{alice.PublicKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	huge := make([]byte, maxScriptPush+1)
+
+	// a peer controls every field of the inputs it sends, none of them may panic the node
+	tests := map[string]TxInput{
+		"public key":         {PubKey: huge, Signature: []byte{1}},
+		"signature":          {PubKey: alice.PublicKey, Signature: huge},
+		"multisig signature": {Multisig: policy, Signatures: [][]byte{huge}},
+	}
+	for name, vin := range tests {
+		vin.Txid = genesis.Transactions[0].ID
+		tx := Transaction{nil, []TxInput{vin}, []TxOutput{*NewTxOutput(subsidy, string(alice.GetAddress()))}, 0}
+		tx.ID = tx.Hash()
+		if bc.VerifyTransaction(&tx) {
+			t.Errorf("%s of %d bytes: the transaction verifies", name, len(huge))
+		}
+	}
+}
@@ -0,0 +1,554 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+const protocol = "tcp"
+
+// nodeVersion is the version of the wire protocol, bump it whenever the encoding or the validity of the blocks
+// and transactions exchanged changes. Nodes speaking another version are rejected at the handshake
+// 1 - initial protocol
+// 2 - blocks record their proof of work target
+// 3 - blocks record their height
+// 4 - multisig outputs and inputs
+// 5 - script outputs and inputs
+// 6 - transaction lock times and input sequences
+// 7 - signature hashes covering the values of the spent outputs and the genesis block hash
+const nodeVersion = 7
+
+// commandLength is the size of the command header prepended to every message
+const commandLength = 12
+
+const dialTimeout = 5 * time.Second
+
+// readTimeout bounds the time a peer has to send a message, so a silent connection doesn't stay open
+const readTimeout = 30 * time.Second
+
+// maxMessageSize bounds the size of a message, larger ones are dropped without being read in full
+const maxMessageSize = 16 << 20
+
+// Server is a node of the network. It keeps its own blockchain in sync with the nodes it knows,
+// relays new transactions and blocks, and mines the received transactions if it has a mining address
+//
+// Every message goes over its own connection: a command padded to commandLength bytes followed by a
+// gob-encoded payload. The connection is closed once the message is written
+type Server struct {
+	// MaxBlockTxs is the maximum number of pooled transactions a mined block includes
+	MaxBlockTxs int
+
+	nodeAddress   string
+	miningAddress string
+	bc            *Blockchain
+	listener      net.Listener
+
+	// mu guards the blockchain and everything below
+	mu              sync.Mutex
+	knownNodes      []string
+	rejectedNodes   map[string]bool
+	blocksInTransit [][]byte
+	mempool         *Mempool
+
+	wg sync.WaitGroup
+}
+
+type blockMsg struct {
+	AddrFrom string
+	Block    []byte
+}
+
+type getBlocksMsg struct {
+	AddrFrom string
+}
+
+type getDataMsg struct {
+	AddrFrom string
+	Type     string
+	ID       []byte
+}
+
+type invMsg struct {
+	AddrFrom string
+	Type     string
+	Items    [][]byte
+}
+
+type txMsg struct {
+	AddrFrom    string
+	Transaction []byte
+}
+
+type versionMsg struct {
+	Version    int
+	BestHeight int
+	AddrFrom   string
+}
+
+// peerMsg is the sender every message carries, decoded alone to drop the messages of rejected nodes
+type peerMsg struct {
+	AddrFrom string
+}
+
+// NewServer creates a node listening on nodeAddress, seeds are the nodes it first connects to
+// An empty miningAddress makes a node that only relays
+func NewServer(nodeAddress, miningAddress string, bc *Blockchain, seeds []string) *Server {
+	s := &Server{
+		MaxBlockTxs:   defaultMaxBlockTxs,
+		nodeAddress:   nodeAddress,
+		miningAddress: miningAddress,
+		bc:            bc,
+		rejectedNodes: make(map[string]bool),
+		mempool:       NewMempool(bc),
+	}
+	for _, node := range seeds {
+		if node != nodeAddress {
+			s.knownNodes = append(s.knownNodes, node)
+		}
+	}
+
+	return s
+}
+
+// Start starts listening and announces the node to the seeds, connections are served in the background
+// Listening on port 0 picks a free port, Addr returns the actual address
+func (s *Server) Start() error {
+	ln, err := net.Listen(protocol, s.nodeAddress)
+	if err != nil {
+		return err
+	}
+	s.listener = ln
+	s.nodeAddress = ln.Addr().String()
+
+	s.wg.Add(1)
+	go s.serve()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, node := range s.knownNodes {
+		s.sendVersion(node)
+	}
+
+	return nil
+}
+
+// Stop closes the listener and waits for the connections being handled
+func (s *Server) Stop() {
+	s.listener.Close()
+	s.wg.Wait()
+}
+
+// Addr returns the address the node listens on
+func (s *Server) Addr() string {
+	return s.nodeAddress
+}
+
+// BestHeight returns the height of the node's blockchain
+func (s *Server) BestHeight() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.bc.GetBestHeight()
+}
+
+// Tip returns the hash of the last block of the node's blockchain
+func (s *Server) Tip() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.bc.tip
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			// the listener is closed when the server stops
+			return
+		}
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handleConnection(conn)
+		}()
+	}
+}
+
+func (s *Server) handleConnection(conn net.Conn) {
+	conn.SetReadDeadline(time.Now().Add(readTimeout))
+	request, err := ioutil.ReadAll(io.LimitReader(conn, maxMessageSize+1))
+	conn.Close()
+	if err != nil {
+		log.Println("Error reading request:", err)
+		return
+	}
+	if len(request) > maxMessageSize {
+		log.Println("Error reading request: message too long")
+		return
+	}
+	if len(request) < commandLength {
+		log.Println("Error reading request: message too short")
+		return
+	}
+
+	command := bytesToCommand(request[:commandLength])
+	payload := bytes.NewReader(request[commandLength:])
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// a rejected node can only send its version again, the rest of what it sends may not even decode
+	if command != "version" && s.fromRejectedNode(request[commandLength:]) {
+		log.Printf("Ignoring %q from a node speaking another protocol version\n", command)
+		return
+	}
+
+	switch command {
+	case "block":
+		s.handleBlock(payload)
+	case "inv":
+		s.handleInv(payload)
+	case "getblocks":
+		s.handleGetBlocks(payload)
+	case "getdata":
+		s.handleGetData(payload)
+	case "tx":
+		s.handleTx(payload)
+	case "version":
+		s.handleVersion(payload)
+	default:
+		log.Printf("Unknown command %q\n", command)
+	}
+}
+
+func (s *Server) handleBlock(payload *bytes.Reader) {
+	var msg blockMsg
+	if !decodePayload(payload, &msg) {
+		return
+	}
+
+	block := &Block{}
+	if !decodePayload(bytes.NewReader(msg.Block), block) {
+		return
+	}
+	isNew := !s.bc.HasBlock(block.Hash)
+	oldTip := s.bc.tip
+
+	err := s.bc.AddBlock(block)
+	if errors.Is(err, ErrOrphanBlock) {
+		// we are missing some blocks of its branch, ask for the whole chain
+		s.blocksInTransit = nil
+		s.sendGetBlocks(msg.AddrFrom)
+		return
+	}
+	if err != nil {
+		log.Println("Rejected block:", err)
+		s.blocksInTransit = nil
+		return
+	}
+
+	s.mempool.RemoveBlock(block)
+	// the transactions of the blocks the new branch replaced are not mined anymore
+	leftBehind, err := s.bc.LeftBehind(oldTip)
+	if err != nil {
+		log.Panic(err)
+	}
+	s.mempool.AddLeftBehind(leftBehind)
+
+	if len(s.blocksInTransit) > 0 {
+		blockHash := s.blocksInTransit[0]
+		s.blocksInTransit = s.blocksInTransit[1:]
+		s.sendGetData(msg.AddrFrom, "block", blockHash)
+		return
+	}
+
+	// announce the tip once we are in sync, the others fetch what they miss
+	if isNew && bytes.Compare(block.Hash, s.bc.tip) == 0 {
+		s.broadcastInv("block", [][]byte{block.Hash}, msg.AddrFrom)
+	}
+}
+
+func (s *Server) handleInv(payload *bytes.Reader) {
+	var msg invMsg
+	if !decodePayload(payload, &msg) {
+		return
+	}
+
+	switch msg.Type {
+	case "block":
+		// items go from the tip to the genesis block, request the missing ones oldest first
+		var missing [][]byte
+		for i := len(msg.Items) - 1; i >= 0; i-- {
+			if !s.bc.HasBlock(msg.Items[i]) {
+				missing = append(missing, msg.Items[i])
+			}
+		}
+		if len(missing) == 0 {
+			return
+		}
+
+		s.blocksInTransit = missing[1:]
+		s.sendGetData(msg.AddrFrom, "block", missing[0])
+	case "tx":
+		for _, txID := range msg.Items {
+			if !s.mempool.Has(txID) {
+				s.sendGetData(msg.AddrFrom, "tx", txID)
+			}
+		}
+	}
+}
+
+func (s *Server) handleGetBlocks(payload *bytes.Reader) {
+	var msg getBlocksMsg
+	if !decodePayload(payload, &msg) {
+		return
+	}
+
+	s.sendInv(msg.AddrFrom, "block", s.bc.GetBlockHashes())
+}
+
+func (s *Server) handleGetData(payload *bytes.Reader) {
+	var msg getDataMsg
+	if !decodePayload(payload, &msg) {
+		return
+	}
+
+	switch msg.Type {
+	case "block":
+		block, err := s.bc.GetBlock(msg.ID)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		s.sendBlock(msg.AddrFrom, block)
+	case "tx":
+		tx, ok := s.mempool.Get(msg.ID)
+		if !ok {
+			return
+		}
+		s.sendTx(msg.AddrFrom, &tx)
+	}
+}
+
+func (s *Server) handleTx(payload *bytes.Reader) {
+	var msg txMsg
+	if !decodePayload(payload, &msg) {
+		return
+	}
+
+	var tx Transaction
+	if !decodePayload(bytes.NewReader(msg.Transaction), &tx) {
+		return
+	}
+	if s.mempool.Has(tx.ID) {
+		return
+	}
+	err := s.mempool.Add(&tx)
+	if err != nil {
+		log.Printf("Rejected transaction %x: %v\n", tx.ID, err)
+		return
+	}
+
+	s.broadcastInv("tx", [][]byte{tx.ID}, msg.AddrFrom)
+
+	if s.miningAddress != "" {
+		s.mineTransactions()
+	}
+}
+
+func (s *Server) handleVersion(payload *bytes.Reader) {
+	var msg versionMsg
+	if !decodePayload(payload, &msg) {
+		return
+	}
+
+	if msg.Version != nodeVersion {
+		log.Printf("Rejecting %s, it speaks protocol version %d instead of %d\n", msg.AddrFrom, msg.Version, nodeVersion)
+		if msg.AddrFrom != "" && !s.rejectedNodes[msg.AddrFrom] {
+			s.rejectedNodes[msg.AddrFrom] = true
+			s.removeNode(msg.AddrFrom)
+			// answer once with our version, so the node rejects us too instead of sending what we can't decode
+			s.sendVersion(msg.AddrFrom)
+		}
+		return
+	}
+	delete(s.rejectedNodes, msg.AddrFrom)
+
+	myBestHeight := s.bc.GetBestHeight()
+	if myBestHeight < msg.BestHeight {
+		s.sendGetBlocks(msg.AddrFrom)
+	} else if myBestHeight > msg.BestHeight {
+		s.sendVersion(msg.AddrFrom)
+	}
+
+	s.addNode(msg.AddrFrom)
+}
+
+// mineTransactions mines a block with transactions from the mempool and announces it
+func (s *Server) mineTransactions() {
+	txs := s.mempool.Select(s.MaxBlockTxs)
+	if len(txs) == 0 {
+		return
+	}
+
+	cbTx := NewRewardTX(s.miningAddress, "", subsidy+s.bc.TotalFees(txs))
+	txs = append([]*Transaction{cbTx}, txs...)
+
+	newBlock := s.bc.MineBlock(txs)
+	fmt.Printf("New block %x is mined!\n", newBlock.Hash)
+
+	s.mempool.RemoveBlock(newBlock)
+
+	s.broadcastInv("block", [][]byte{newBlock.Hash}, "")
+}
+
+func (s *Server) addNode(addr string) {
+	if addr == "" || addr == s.nodeAddress {
+		return
+	}
+	for _, node := range s.knownNodes {
+		if node == addr {
+			return
+		}
+	}
+	s.knownNodes = append(s.knownNodes, addr)
+}
+
+func (s *Server) removeNode(addr string) {
+	var updatedNodes []string
+	for _, node := range s.knownNodes {
+		if node != addr {
+			updatedNodes = append(updatedNodes, node)
+		}
+	}
+	s.knownNodes = updatedNodes
+}
+
+// fromRejectedNode tells whether a message payload was sent by a node rejected at the handshake
+func (s *Server) fromRejectedNode(payload []byte) bool {
+	var msg peerMsg
+	err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&msg)
+	return err == nil && s.rejectedNodes[msg.AddrFrom]
+}
+
+func (s *Server) broadcastInv(kind string, items [][]byte, except string) {
+	for _, node := range s.knownNodes {
+		if node != except {
+			s.sendInv(node, kind, items)
+		}
+	}
+}
+
+func (s *Server) sendBlock(addr string, b *Block) {
+	s.sendData(addr, buildMessage("block", blockMsg{s.nodeAddress, b.Serialize()}))
+}
+
+func (s *Server) sendGetBlocks(addr string) {
+	s.sendData(addr, buildMessage("getblocks", getBlocksMsg{s.nodeAddress}))
+}
+
+func (s *Server) sendGetData(addr, kind string, id []byte) {
+	s.sendData(addr, buildMessage("getdata", getDataMsg{s.nodeAddress, kind, id}))
+}
+
+func (s *Server) sendInv(addr, kind string, items [][]byte) {
+	s.sendData(addr, buildMessage("inv", invMsg{s.nodeAddress, kind, items}))
+}
+
+func (s *Server) sendTx(addr string, tnx *Transaction) {
+	s.sendData(addr, buildMessage("tx", txMsg{s.nodeAddress, tnx.Serialize()}))
+}
+
+func (s *Server) sendVersion(addr string) {
+	s.sendData(addr, buildMessage("version", versionMsg{nodeVersion, s.bc.GetBestHeight(), s.nodeAddress}))
+}
+
+// sendData sends a message to a node, a node that can't be reached is forgotten
+func (s *Server) sendData(addr string, data []byte) {
+	if addr == "" {
+		return
+	}
+
+	err := sendMessage(addr, data)
+	if err != nil {
+		log.Printf("%s is not available: %v\n", addr, err)
+		s.removeNode(addr)
+	}
+}
+
+// SendTransaction submits a transaction to the node at addr, which verifies and relays it
+func SendTransaction(addr string, tnx *Transaction) error {
+	return sendMessage(addr, buildMessage("tx", txMsg{"", tnx.Serialize()}))
+}
+
+func sendMessage(addr string, data []byte) error {
+	conn, err := net.DialTimeout(protocol, addr, dialTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write(data)
+	return err
+}
+
+func buildMessage(command string, payload interface{}) []byte {
+	return append(commandToBytes(command), gobEncode(payload)...)
+}
+
+func commandToBytes(command string) []byte {
+	var bytes [commandLength]byte
+
+	for i, c := range command {
+		bytes[i] = byte(c)
+	}
+
+	return bytes[:]
+}
+
+func bytesToCommand(bytes []byte) string {
+	var command []byte
+
+	for _, b := range bytes {
+		if b != 0x0 {
+			command = append(command, b)
+		}
+	}
+
+	return fmt.Sprintf("%s", command)
+}
+
+func gobEncode(data interface{}) []byte {
+	var buff bytes.Buffer
+
+	enc := gob.NewEncoder(&buff)
+	err := enc.Encode(data)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return buff.Bytes()
+}
+
+// decodePayload decodes gob data received from the network, malformed data is logged and dropped
+func decodePayload(payload *bytes.Reader, msg interface{}) bool {
+	dec := gob.NewDecoder(payload)
+	err := dec.Decode(msg)
+	if err != nil {
+		log.Println("Error decoding message:", err)
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+// useTestDir runs the test inside a temporary directory with an easy difficulty,
+// the returned function restores both
+func useTestDir(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "glockchain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chdir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bits := initialTargetBits
+	initialTargetBits = 8
+
+	return func() {
+		initialTargetBits = bits
+		os.Chdir(wd)
+		os.RemoveAll(dir)
+	}
+}
+
+func copyFile(t *testing.T, src, dst string) {
+	data, err := ioutil.ReadFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(dst, data, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(20 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func startTestNode(t *testing.T, nodeID, miner string, seeds ...string) *Server {
+	bc, err := NewBlockchain(nodeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewServer("127.0.0.1:0", miner, bc, seeds)
+	err = server.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server
+}
+
+func stopTestNode(server *Server) {
+	server.Stop()
+	server.bc.Close()
+}
+
+func TestNodesSyncBlocksAndTransactions(t *testing.T) {
+	defer useTestDir(t)()
+
+	wallet := NewWallet()
+	miner := NewWallet()
+	address := string(wallet.GetAddress())
+	minerAddress := string(miner.GetAddress())
+
+	// every node starts from the same genesis block
+	bc, err := CreateBlockchain(address, "", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc.Close()
+	copyFile(t, dbPath("a"), dbPath("b"))
+	copyFile(t, dbPath("a"), dbPath("c"))
+
+	// node a is ahead of the others
+	bc, err = NewBlockchain("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc.MineBlock([]*Transaction{NewCoinbaseTX(address, "")})
+	bc.MineBlock([]*Transaction{NewCoinbaseTX(address, "")})
+	bc.Close()
+
+	nodeA := startTestNode(t, "a", "")
+	defer stopTestNode(nodeA)
+	nodeB := startTestNode(t, "b", minerAddress, nodeA.Addr())
+	defer stopTestNode(nodeB)
+	nodeC := startTestNode(t, "c", "", nodeA.Addr())
+	defer stopTestNode(nodeC)
+
+	inSync := func(height int) func() bool {
+		return func() bool {
+			tip := nodeA.Tip()
+			return nodeA.BestHeight() == height &&
+				bytes.Equal(nodeB.Tip(), tip) && bytes.Equal(nodeC.Tip(), tip)
+		}
+	}
+	waitFor(t, "nodes to catch up", inSync(2))
+
+	// a transaction submitted to c reaches the miner b through a, and the new block reaches every node
+	nodeC.mu.Lock()
+	tx := NewUTXOTransaction(wallet, minerAddress, 4, 1, &UTXOSet{nodeC.bc})
+	nodeC.mu.Unlock()
+
+	err = SendTransaction(nodeC.Addr(), tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the transaction to be mined and relayed", inSync(3))
+
+	nodeC.mu.Lock()
+	defer nodeC.mu.Unlock()
+	balance := 0
+	for _, out := range (UTXOSet{nodeC.bc}).FindUTXO(HashPubKey(miner.PublicKey)) {
+		balance += out.Value
+	}
+	// the miner gets the payment, the subsidy and the fee
+	if balance != 4+subsidy+1 {
+		t.Errorf("miner balance on c = %d, want %d", balance, 4+subsidy+1)
+	}
+	if nodeB.mempool.Size() != 0 {
+		t.Errorf("miner still has %d transactions in its mempool", nodeB.mempool.Size())
+	}
+}
+
+func TestNodeRejectsOtherProtocolVersions(t *testing.T) {
+	defer useTestDir(t)()
+
+	wallet := NewWallet()
+	address := string(wallet.GetAddress())
+	bc, err := CreateBlockchain(address, "", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc.MineBlock([]*Transaction{NewCoinbaseTX(address, "")})
+	next := nextBlock(t, bc, bc.tip, NewCoinbaseTX(address, ""))
+	bc.Close()
+
+	peer := "127.0.0.1:1"
+	nodeA := startTestNode(t, "a", "")
+	defer stopTestNode(nodeA)
+	isRejected := func() bool {
+		nodeA.mu.Lock()
+		defer nodeA.mu.Unlock()
+		return nodeA.rejectedNodes[peer]
+	}
+
+	err = sendMessage(nodeA.Addr(), buildMessage("version", versionMsg{nodeVersion + 1, 0, peer}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the peer to be rejected", isRejected)
+	nodeA.mu.Lock()
+	if len(nodeA.knownNodes) != 0 {
+		t.Errorf("known nodes = %v, want none", nodeA.knownNodes)
+	}
+	nodeA.mu.Unlock()
+
+	// what a rejected peer sends is dropped, until it speaks the same version
+	err = sendMessage(nodeA.Addr(), buildMessage("block", blockMsg{peer, next.Serialize()}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if bytes.Equal(nodeA.Tip(), next.Hash) {
+		t.Fatal("the block of a rejected peer is added")
+	}
+
+	err = sendMessage(nodeA.Addr(), buildMessage("version", versionMsg{nodeVersion, 0, peer}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the peer to be accepted", func() bool { return !isRejected() })
+	err = sendMessage(nodeA.Addr(), buildMessage("block", blockMsg{peer, next.Serialize()}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the block to be added", func() bool { return bytes.Equal(nodeA.Tip(), next.Hash) })
+}
+
+func TestNodeSurvivesMalformedMessages(t *testing.T) {
+	defer useTestDir(t)()
+
+	wallet := NewWallet()
+	address := string(wallet.GetAddress())
+	bc, err := CreateBlockchain(address, "", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tip := bc.tip
+	next := nextBlock(t, bc, tip, NewCoinbaseTX(address, ""))
+	bc.Close()
+
+	nodeA := startTestNode(t, "a", "")
+	defer stopTestNode(nodeA)
+
+	// a block without transactions has no merkle root, and a message over the size limit is not read
+	empty := &Block{Timestamp: next.Timestamp, PrevBlockHash: tip, Hash: next.Hash, Target: next.Target, Height: 1}
+	err = sendMessage(nodeA.Addr(), buildMessage("block", blockMsg{"127.0.0.1:1", empty.Serialize()}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the node stops reading past the limit, the end of the write may fail
+	sendMessage(nodeA.Addr(), append(commandToBytes("tx"), make([]byte, maxMessageSize)...))
+
+	err = sendMessage(nodeA.Addr(), buildMessage("block", blockMsg{"127.0.0.1:1", next.Serialize()}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the valid block to be added", func() bool { return bytes.Equal(nodeA.Tip(), next.Hash) })
+}
@@ -8,18 +8,27 @@ import (
 	"crypto/sha256"
 	"encoding/gob"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
 	"math/big"
+	"strings"
 )
 
 const subsidy = 10
 
+// maxMoney bounds the value of an output and the sums of values. It is far above the coins the chain will ever
+// hold, and low enough that adding two values can't overflow
+const maxMoney = 1 << 50
+
 // Transaction defines the structure of a transaction in our blockchain
+// A transaction with a LockTime can't be in a block below that height, or before that Unix time when it is
+// lockTimeThreshold or more
 type Transaction struct {
-	ID   []byte
-	Vin  []TxInput
-	Vout []TxOutput
+	ID       []byte
+	Vin      []TxInput
+	Vout     []TxOutput
+	LockTime int
 }
 
 // SetID sets ID of a transaction, it's a hash of a transaction itself
@@ -68,82 +77,158 @@ func (tx *Transaction) Hash() []byte {
 	return hash[:]
 }
 
-// Sign signs a transaction
+// String returns a human-readable representation of a transaction: its ID, the outputs its inputs spend, and
+// the value and address of its outputs
+func (tx Transaction) String() string {
+	var lines []string
+
+	lines = append(lines, fmt.Sprintf("--- Transaction %x:", tx.ID))
+	for i, input := range tx.Vin {
+		if tx.isCoinbase() {
+			lines = append(lines, fmt.Sprintf("     Input %d: coinbase", i))
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("     Input %d: %x:%d", i, input.Txid, input.Vout))
+	}
+	for i, output := range tx.Vout {
+		if output.Script != nil {
+			lines = append(lines, fmt.Sprintf("     Output %d: %d to script %x", i, output.Value, output.Script))
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("     Output %d: %d to %s", i, output.Value, output.Address()))
+	}
+	if tx.LockTime != 0 {
+		lines = append(lines, fmt.Sprintf("     Lock time: %d", tx.LockTime))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// finalize sets the ID of a signed transaction
+// The ID covers the signatures too, so it is set once the transaction is signed
+func (tx *Transaction) finalize() {
+	tx.ID = tx.Hash()
+}
+
+// Sign signs a transaction for the chain starting with the block genesis, the signatures can't be replayed on
+// another chain
 // A transaction unlock previous outputs, redistribute their values, and lock new outputs, the following data must be signed
 //	1. Public key hashes stored in unlocked outputs. This identifies "sender" of a transaction - TxInput.PubKey
 //	2. Public key hashes stored in new, locked, outputs. This identifies "recipient" of a transaction - TxOutput.PubKeyHash
 //	3. Values of new outputs - TxOutput.Value
-func (tx *Transaction) Sign(privKey ecdsa.PrivateKey, prevTxs map[string]Transaction) {
+func (tx *Transaction) Sign(privKey ecdsa.PrivateKey, prevTxs map[string]Transaction, genesis []byte) {
 	if tx.isCoinbase() {
 		return
 	}
 
+	for inID, prevOut := range tx.spentOutputs(prevTxs) {
+		tx.signInput(inID, privKey, prevOut, genesis)
+	}
+}
+
+// spentOutputs returns the outputs the inputs spend, in the same order, looked up in prevTxs
+func (tx *Transaction) spentOutputs(prevTxs map[string]Transaction) []TxOutput {
+	var prevOuts []TxOutput
+	for _, vin := range tx.Vin {
+		prevOuts = append(prevOuts, prevTxs[hex.EncodeToString(vin.Txid)].Vout[vin.Vout])
+	}
+	return prevOuts
+}
+
+// signInput signs the input at inID, spending prevOut, the other inputs are left as they are
+func (tx *Transaction) signInput(inID int, privKey ecdsa.PrivateKey, prevOut TxOutput, genesis []byte) {
+	tx.Vin[inID].Signature = signHash(privKey, tx.sigHash(inID, prevOut, genesis))
+}
+
+// sigHash returns what the signatures of the input at inID sign: the trimmed transaction, with the hash or the
+// script the spent output is locked with in place of the public key of the input, the value of that output and
+// the genesis hash of the chain. The value is signed so that a signer shown a wrong value, and so a wrong fee,
+// makes a signature the chain rejects
+func (tx *Transaction) sigHash(inID int, prevOut TxOutput, genesis []byte) []byte {
 	txCopy := tx.TrimmedCopy()
 
-	for inID, vin := range txCopy.Vin {
-		prevTx := prevTxs[hex.EncodeToString(vin.Txid)]
-		// just a double check
-		txCopy.Vin[inID].Signature = nil
-		// refers to the output it consumes, this is for hashing purpose
-		txCopy.Vin[inID].PubKey = prevTx.Vout[vin.Vout].PubKeyHash
-		txCopy.ID = txCopy.Hash()
-		txCopy.Vin[inID].PubKey = nil
-
-		// sign the transaction ID with privKey
-		r, s, err := ecdsa.Sign(rand.Reader, &privKey, txCopy.ID)
-		if err != nil {
-			log.Panic(err)
-		}
+	// refers to the output it consumes, this is for hashing purpose
+	txCopy.Vin[inID].PubKey = prevOut.PubKeyHash
+	if prevOut.Script != nil {
+		txCopy.Vin[inID].PubKey = prevOut.Script
+	}
 
-		signature := append(r.Bytes(), s.Bytes()...)
+	data := bytes.Join([][]byte{txCopy.Hash(), IntToHex(int64(prevOut.Value)), genesis}, []byte{})
+	hash := sha256.Sum256(data)
+	return hash[:]
+}
 
-		tx.Vin[inID].Signature = signature
+// signHash signs hash with privKey, the signature is r followed by s
+func signHash(privKey ecdsa.PrivateKey, hash []byte) []byte {
+	r, s, err := ecdsa.Sign(rand.Reader, &privKey, hash)
+	if err != nil {
+		log.Panic(err)
 	}
+
+	// r and s take the full size of the curve, so the signature can be split back in half
+	keyLen := (privKey.Curve.Params().BitSize + 7) / 8
+	signature := make([]byte, 2*keyLen)
+	r.FillBytes(signature[:keyLen])
+	s.FillBytes(signature[keyLen:])
+	return signature
+}
+
+// verifyHash checks a signature made by signHash, pubKey being the X and Y coordinates of the key
+func verifyHash(pubKey, hash, signature []byte) bool {
+	r := big.Int{}
+	s := big.Int{}
+	sigLen := len(signature)
+	r.SetBytes(signature[:(sigLen / 2)])
+	s.SetBytes(signature[(sigLen / 2):])
+
+	x := big.Int{}
+	y := big.Int{}
+	keyLen := len(pubKey)
+	x.SetBytes(pubKey[:(keyLen / 2)])
+	y.SetBytes(pubKey[(keyLen / 2):])
+
+	rawPubKey := ecdsa.PublicKey{Curve: elliptic.P256(), X: &x, Y: &y}
+	return ecdsa.Verify(&rawPubKey, hash, &r, &s)
 }
 
 // TrimmedCopy trims a transaction and only return the information required to have a sig
-//	which includes all the inputs and outputs with TxInput.Signature and TxInput.PubKey set to nil
+//	which includes all the inputs and outputs with TxInput.Signature and TxInput.PubKey set to nil,
+//	as well as the multisig policies, signatures and scripts of the inputs. Lock times are kept
 func (tx *Transaction) TrimmedCopy() Transaction {
 	var inputs []TxInput
 	var outputs []TxOutput
 
 	for _, vin := range tx.Vin {
-		inputs = append(inputs, TxInput{vin.Txid, vin.Vout, nil, nil})
+		inputs = append(inputs, TxInput{vin.Txid, vin.Vout, nil, nil, nil, nil, nil, vin.Sequence})
 	}
 	for _, vout := range tx.Vout {
-		outputs = append(outputs, TxOutput{vout.Value, vout.PubKeyHash})
+		outputs = append(outputs, TxOutput{vout.Value, vout.PubKeyHash, vout.Multisig, vout.Script})
 	}
 
-	txCopy := Transaction{tx.ID, inputs, outputs}
+	txCopy := Transaction{tx.ID, inputs, outputs, tx.LockTime}
 	return txCopy
 }
 
-// Verify verifies a transaction
-func (tx *Transaction) Verify(prevTXs map[string]Transaction) bool {
-	txCopy := tx.TrimmedCopy()
-	curve := elliptic.P256()
+// Verify verifies a transaction in a block at height of the chain starting with the block of hash genesis
+// The unlocking script of every input must satisfy the locking script of the output it spends
+func (tx *Transaction) Verify(prevTXs map[string]Transaction, height int, genesis []byte) bool {
+	return tx.verifyInputs(tx.spentOutputs(prevTXs), height, genesis)
+}
 
+// verifyInputs works like Verify, with the outputs the inputs spend, in the same order
+func (tx *Transaction) verifyInputs(prevOuts []TxOutput, height int, genesis []byte) bool {
 	for inID, vin := range tx.Vin {
-		prevTx := prevTXs[hex.EncodeToString(vin.Txid)]
-		txCopy.Vin[inID].Signature = nil
-		txCopy.Vin[inID].PubKey = prevTx.Vout[vin.Vout].PubKeyHash
-		txCopy.ID = txCopy.Hash()
-		txCopy.Vin[inID].PubKey = nil
-
-		r := big.Int{}
-		s := big.Int{}
-		sigLen := len(vin.Signature)
-		r.SetBytes(vin.Signature[:(sigLen / 2)])
-		s.SetBytes(vin.Signature[(sigLen / 2):])
-
-		x := big.Int{}
-		y := big.Int{}
-		keyLen := len(vin.PubKey)
-		x.SetBytes(vin.PubKey[:(keyLen / 2)])
-		y.SetBytes(vin.PubKey[(keyLen / 2):])
-
-		rawPubKey := ecdsa.PublicKey{curve, &x, &y}
-		if ecdsa.Verify(&rawPubKey, txCopy.ID, &r, &s) == false {
+		prevOut := prevOuts[inID]
+		ctx := scriptContext{tx.sigHash(inID, prevOut, genesis), height}
+		unlocking, err := vin.UnlockingScript()
+		if err != nil {
+			return false
+		}
+		locking, err := prevOut.LockingScript()
+		if err != nil {
+			return false
+		}
+		if runScripts(unlocking, locking, ctx) != nil {
 			return false
 		}
 	}
@@ -151,56 +236,193 @@ func (tx *Transaction) Verify(prevTXs map[string]Transaction) bool {
 	return true
 }
 
-// NewCoinbaseTX creates new coinbase transaction and return its pointer
+// OutputValue returns the sum of the values of the outputs
+// Every value must be between 0 and maxMoney, and so must the sum
+func (tx *Transaction) OutputValue() (int, error) {
+	value := 0
+	for outID, out := range tx.Vout {
+		if out.Value < 0 || out.Value > maxMoney {
+			return 0, fmt.Errorf("Transaction %x output %d has an invalid value %d", tx.ID, outID, out.Value)
+		}
+		value += out.Value
+		if value > maxMoney {
+			return 0, fmt.Errorf("Transaction %x pays more than %d", tx.ID, maxMoney)
+		}
+	}
+	return value, nil
+}
+
+// NewCoinbaseTX creates new coinbase transaction paying the subsidy and return its pointer
 func NewCoinbaseTX(to, data string) *Transaction {
+	return NewRewardTX(to, data, subsidy)
+}
+
+// NewRewardTX creates a coinbase transaction paying reward, which is the subsidy plus the fees of the block
+// Without data, random bytes are used so that rewards to the same address get different IDs
+func NewRewardTX(to, data string, reward int) *Transaction {
 	if data == "" {
-		data = fmt.Sprintf("Reward to '%s'", to)
+		randData := make([]byte, 20)
+		_, err := rand.Read(randData)
+		if err != nil {
+			log.Panic(err)
+		}
+
+		data = fmt.Sprintf("%x", randData)
 	}
 
-	txin := TxInput{[]byte{}, -1, nil, []byte(data)}
-	txout := NewTxOutput(subsidy, to)
-	tx := Transaction{nil, []TxInput{txin}, []TxOutput{*txout}}
+	txin := TxInput{[]byte{}, -1, nil, []byte(data), nil, nil, nil, 0}
+	txout := NewTxOutput(reward, to)
+	tx := Transaction{nil, []TxInput{txin}, []TxOutput{*txout}, 0}
 	tx.ID = tx.Hash()
 	return &tx
 }
 
-// NewUTXOTransaction generate new transaction based on current utxo table
-func NewUTXOTransaction(from, to string, amount int, bc *Blockchain) *Transaction {
-	var inputs []TxInput
+// Payment is an amount paid to an address by a transaction
+type Payment struct {
+	Address string `json:"address"`
+	Amount  int    `json:"amount"`
+}
+
+var (
+	// ErrInvalidPayment is returned when building a transaction with an invalid list of payments
+	ErrInvalidPayment = errors.New("Payment is invalid")
+	// ErrNotEnoughFunds is returned when a wallet can't pay for a transaction
+	ErrNotEnoughFunds = errors.New("NOT enough money")
+)
+
+// checkPayments rejects empty lists, invalid or repeated addresses and amounts that aren't positive
+func checkPayments(payments []Payment) error {
+	if len(payments) == 0 {
+		return fmt.Errorf("%w: no recipient", ErrInvalidPayment)
+	}
+
+	seen := make(map[string]bool)
+	for _, payment := range payments {
+		if !ValidateAddress(payment.Address) {
+			return fmt.Errorf("%w: address %q is not valid", ErrInvalidPayment, payment.Address)
+		}
+		if seen[payment.Address] {
+			return fmt.Errorf("%w: address %s is paid twice", ErrInvalidPayment, payment.Address)
+		}
+		seen[payment.Address] = true
+		if payment.Amount <= 0 {
+			return fmt.Errorf("%w: amount %d to %s is not positive", ErrInvalidPayment, payment.Amount, payment.Address)
+		}
+	}
+
+	return nil
+}
+
+// paymentOutputs checks payments and returns the outputs paying them
+func paymentOutputs(payments []Payment) ([]TxOutput, error) {
+	err := checkPayments(payments)
+	if err != nil {
+		return nil, err
+	}
+
 	var outputs []TxOutput
+	for _, payment := range payments {
+		outputs = append(outputs, *NewTxOutput(payment.Amount, payment.Address))
+	}
+	return outputs, nil
+}
 
-	wallets, err := NewWallets()
+// NewUTXOTransaction generate new transaction based on current utxo table
+// fee is left to the miner, anything else above amount goes back to the wallet as change
+func NewUTXOTransaction(wallet *Wallet, to string, amount, fee int, UTXOSet *UTXOSet) *Transaction {
+	tx, err := NewPaymentTransaction(wallet, []Payment{{to, amount}}, fee, 0, nil, UTXOSet)
 	if err != nil {
 		log.Panic(err)
 	}
-	wallet := wallets.GetWallet(from)
-	pubKeyHash := HashPubKey(wallet.PublicKey)
-	acc, validOutputs := bc.FindSpendableOutputs(pubKeyHash, amount)
+	return tx
+}
 
-	if acc < amount {
-		log.Panic("Error: NOT enough money")
+// NewPaymentTransaction generates a transaction paying every payment at once, with a single change output
+// The payments are checked before anything is signed. selector picks the outputs to spend, LargestFirst if nil.
+// A lockTime other than 0 keeps the transaction out of the blocks below that height or before that time
+func NewPaymentTransaction(wallet *Wallet, payments []Payment, fee, lockTime int, selector CoinSelector, UTXOSet *UTXOSet) (*Transaction, error) {
+	outputs, err := paymentOutputs(payments)
+	if err != nil {
+		return nil, err
 	}
+	return newSignedTransaction(wallet, outputs, fee, lockTime, selector, UTXOSet)
+}
 
-	for txid, outs := range validOutputs {
-		txID, err := hex.DecodeString(txid)
-		if err != nil {
-			log.Panic(err)
-		}
+// newSignedTransaction builds a transaction with outputs, spending outputs of wallet and paying it the change,
+// and signs it
+func newSignedTransaction(wallet *Wallet, outputs []TxOutput, fee, lockTime int, selector CoinSelector, UTXOSet *UTXOSet) (*Transaction, error) {
+	tx, _, err := newUnsignedTransaction(string(wallet.GetAddress()), outputs, fee, selector, UTXOSet)
+	if err != nil {
+		return nil, err
+	}
+	tx.LockTime = lockTime
+	for i := range tx.Vin {
+		tx.Vin[i].PubKey = wallet.PublicKey
+	}
 
-		for _, out := range outs {
-			input := TxInput{txID, out, nil, wallet.PublicKey}
-			inputs = append(inputs, input)
-		}
+	UTXOSet.Blockchain.SignTransaction(tx, wallet.PrivateKey)
+	tx.finalize()
+
+	return tx, nil
+}
+
+// newUnsignedTransaction builds a transaction with outputs, and a change output, from the outputs of address from,
+// along with the outputs it spends. What unlocks the inputs, public key or multisig policy, is left to the caller
+func newUnsignedTransaction(from string, outputs []TxOutput, fee int, selector CoinSelector, UTXOSet *UTXOSet) (*Transaction, []SpendableOutput, error) {
+	var inputs []TxInput
+
+	amount := 0
+	for _, out := range outputs {
+		amount += out.Value
 	}
 
-	outputs = append(outputs, *NewTxOutput(amount, to))
-	if acc > amount {
-		outputs = append(outputs, *NewTxOutput(acc-amount, from))
+	if selector == nil {
+		selector = LargestFirst{}
+	}
+	_, pubKeyHash := decodeAddress(from)
+	selected, err := selector.Select(UTXOSet.FindSpendable(pubKeyHash), amount+fee)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	tx := Transaction{nil, inputs, outputs}
-	tx.ID = tx.Hash()
-	bc.SignTransaction(&tx, wallet.PrivateKey)
+	acc := 0
+	for _, out := range selected {
+		inputs = append(inputs, TxInput{out.TxID, out.Vout, nil, nil, nil, nil, nil, 0})
+		acc += out.Value
+	}
 
-	return &tx
+	// the change goes to a copy, not to the slice of the caller
+	outputs = append([]TxOutput{}, outputs...)
+	if acc > amount+fee {
+		outputs = append(outputs, *NewTxOutput(acc-amount-fee, from))
+	}
+
+	return &Transaction{nil, inputs, outputs, 0}, selected, nil
+}
+
+// NewUTXOTransactionWithFeeRate works like NewUTXOTransaction, with a fee of feeRate per byte of the serialized transaction
+func NewUTXOTransactionWithFeeRate(wallet *Wallet, to string, amount, feeRate int, UTXOSet *UTXOSet) *Transaction {
+	tx, err := NewPaymentTransactionWithFeeRate(wallet, []Payment{{to, amount}}, feeRate, 0, nil, UTXOSet)
+	if err != nil {
+		log.Panic(err)
+	}
+	return tx
+}
+
+// NewPaymentTransactionWithFeeRate works like NewPaymentTransaction, with a fee of feeRate per byte of the serialized transaction
+// The size depends on the fee, so the transaction is rebuilt until the fee covers it
+func NewPaymentTransactionWithFeeRate(wallet *Wallet, payments []Payment, feeRate, lockTime int, selector CoinSelector, UTXOSet *UTXOSet) (*Transaction, error) {
+	fee := 0
+
+	for {
+		tx, err := NewPaymentTransaction(wallet, payments, fee, lockTime, selector, UTXOSet)
+		if err != nil {
+			return nil, err
+		}
+		required := feeRate * len(tx.Serialize())
+		if fee >= required {
+			return tx, nil
+		}
+		fee = required
+	}
 }
@@ -5,15 +5,72 @@ import (
 )
 
 // TxInput defines the structure of a transaction input
+// An input spending a multisig output has no Signature nor PubKey, but the Multisig policy of the output and
+// Signatures, one slot per key of the policy. An input spending an output locked with a script has its own
+// unlocking Script instead.
+// Sequence is a relative lock: the input can't be in a block until that many blocks after the block of the
+// output it spends, or that many seconds of median time with sequenceTimeFlag set
 type TxInput struct {
-	Txid      []byte // refers to the transaction the input consumed
-	Vout      int    // refers to the index of comsumed outputs within the transaction
-	Signature []byte // Sig of this input
-	PubKey    []byte // PubKey of creator
+	Txid       []byte // refers to the transaction the input consumed
+	Vout       int    // refers to the index of comsumed outputs within the transaction
+	Signature  []byte // Sig of this input
+	PubKey     []byte // PubKey of creator
+	Multisig   *Multisig
+	Signatures [][]byte
+	Script     Script
+	Sequence   int
 }
 
 // UsesKey checks whether the address/public key initiated the transaction
 func (in *TxInput) UsesKey(pubKeyHash []byte) bool {
-	lockingHash := HashPubKey(in.PubKey)
-	return bytes.Compare(lockingHash, pubKeyHash) == 0
+	return bytes.Compare(in.LockHash(), pubKeyHash) == 0
+}
+
+// LockHash returns the hash of the key or of the multisig policy the input unlocks, nil for a script
+func (in *TxInput) LockHash() []byte {
+	if in.Script != nil {
+		return nil
+	}
+	if in.Multisig != nil {
+		return in.Multisig.Hash()
+	}
+	return HashPubKey(in.PubKey)
+}
+
+// Address returns the address the input spends from, nil for a script which has no address
+func (in *TxInput) Address() []byte {
+	if in.Script != nil {
+		return nil
+	}
+	if in.Multisig != nil {
+		return in.Multisig.Address()
+	}
+	return PubKeyHashToAddress(HashPubKey(in.PubKey))
+}
+
+// UnlockingScript returns the script of the input, or the one pushing its signature and public key, or its
+// signatures and multisig policy. It fails when one of them is too long to be pushed
+func (in *TxInput) UnlockingScript() (Script, error) {
+	if in.Script != nil {
+		return in.Script, nil
+	}
+
+	var script Script
+	if in.Multisig != nil {
+		policy := in.Multisig.Serialize()
+		err := checkPushes(append([][]byte{policy}, in.Signatures...)...)
+		if err != nil {
+			return nil, err
+		}
+		for _, signature := range in.Signatures {
+			script = script.AddData(signature)
+		}
+		return script.AddData(policy), nil
+	}
+
+	err := checkPushes(in.Signature, in.PubKey)
+	if err != nil {
+		return nil, err
+	}
+	return script.AddData(in.Signature).AddData(in.PubKey), nil
 }
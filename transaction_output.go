@@ -2,20 +2,53 @@ package main
 
 import (
 	"bytes"
+	"encoding/gob"
+	"log"
 )
 
 // TxOutput defines the structure of a transaction output
+// PubKeyHash is the hash of a multisig policy instead of a public key when Multisig is set
+// A contract output has no PubKeyHash but the Script locking it
 type TxOutput struct {
 	Value      int
 	PubKeyHash []byte
+	Multisig   bool
+	Script     Script
 }
 
 // Lock simply locks an output, using PubKey
+// A multisig address locks it with the hash of its policy
 func (out *TxOutput) Lock(address []byte) {
-	pubKeyHash := Base58Decode(address)
-	// remove version and checksum
-	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-4]
+	addressVersion, pubKeyHash := decodeAddress(string(address))
 	out.PubKeyHash = pubKeyHash
+	out.Multisig = addressVersion == multisigVersion
+}
+
+// Address returns the address the output pays, nil for a script which has no address
+func (out *TxOutput) Address() []byte {
+	if out.Script != nil {
+		return nil
+	}
+	if out.Multisig {
+		return hashToAddress(multisigVersion, out.PubKeyHash)
+	}
+	return PubKeyHashToAddress(out.PubKeyHash)
+}
+
+// LockingScript returns the script of the output, or the standard script checking the key or multisig policy
+// of PubKeyHash. It fails when PubKeyHash is too long to be pushed
+func (out *TxOutput) LockingScript() (Script, error) {
+	if out.Script != nil {
+		return out.Script, nil
+	}
+	err := checkPushes(out.PubKeyHash)
+	if err != nil {
+		return nil, err
+	}
+	if out.Multisig {
+		return payToMultisigScript(out.PubKeyHash), nil
+	}
+	return payToPubKeyHashScript(out.PubKeyHash), nil
 }
 
 // IsLockedWithKey chekcs if provided public key hash was used to lock the output
@@ -23,9 +56,50 @@ func (out *TxOutput) IsLockedWithKey(pubKeyHash []byte) bool {
 	return bytes.Compare(out.PubKeyHash, pubKeyHash) == 0
 }
 
+// NewScriptOutput creates an output locked with script
+func NewScriptOutput(value int, script Script) *TxOutput {
+	return &TxOutput{value, nil, false, script}
+}
+
 // NewTxOutput create a TxOuput
 func NewTxOutput(value int, address string) *TxOutput {
-	txo := &TxOutput{value, nil}
+	txo := &TxOutput{value, nil, false, nil}
 	txo.Lock([]byte(address))
 	return txo
 }
+
+// TxOutputs collects the unspent outputs of one transaction, keyed by their index in Vout
+type TxOutputs struct {
+	Outputs map[int]TxOutput
+}
+
+// NewTxOutputs creates an empty TxOutputs
+func NewTxOutputs() TxOutputs {
+	return TxOutputs{make(map[int]TxOutput)}
+}
+
+// Serialize serializes TxOutputs
+func (outs TxOutputs) Serialize() []byte {
+	var buff bytes.Buffer
+
+	enc := gob.NewEncoder(&buff)
+	err := enc.Encode(outs)
+	if err != nil {
+		log.Panic("Error serializing outputs:", err)
+	}
+
+	return buff.Bytes()
+}
+
+// DeserializeOutputs deserializes TxOutputs
+func DeserializeOutputs(data []byte) TxOutputs {
+	outputs := NewTxOutputs()
+
+	dec := gob.NewDecoder(bytes.NewReader(data))
+	err := dec.Decode(&outputs)
+	if err != nil {
+		log.Panic("Error deserializing outputs:", err)
+	}
+
+	return outputs
+}
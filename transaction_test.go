@@ -0,0 +1,200 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFeeRateCoversTransactionSize(t *testing.T) {
+	defer useTestDir(t)()
+
+	wallet := NewWallet()
+	bc, err := CreateBlockchain(string(wallet.GetAddress()), "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.Close()
+
+	// a rate of 0 would leave no fee, use a tiny one that still fits the genesis reward
+	bob := string(NewWallet().GetAddress())
+	UTXOSet := UTXOSet{bc}
+	tx := NewUTXOTransactionWithFeeRate(wallet, bob, 1, 0, &UTXOSet)
+	fee, err := bc.TransactionFee(tx)
+	if err != nil || fee != 0 {
+		t.Fatalf("fee without rate = %d, %v", fee, err)
+	}
+
+	for i := 0; i < 3; i++ {
+		bc.MineBlock([]*Transaction{NewRewardTX(string(wallet.GetAddress()), "", 1000)})
+	}
+	tx = NewUTXOTransactionWithFeeRate(wallet, bob, 1, 2, &UTXOSet)
+	fee, err = bc.TransactionFee(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := len(tx.Serialize()); fee < 2*size {
+		t.Errorf("fee %d doesn't cover %d bytes at 2 per byte", fee, size)
+	}
+}
+
+func TestCoinbaseCollectsFees(t *testing.T) {
+	defer useTestDir(t)()
+
+	wallet := NewWallet()
+	address := string(wallet.GetAddress())
+	bc, err := CreateBlockchain(address, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.Close()
+
+	UTXOSet := UTXOSet{bc}
+	tx := NewUTXOTransaction(wallet, string(NewWallet().GetAddress()), 5, 2, &UTXOSet)
+	if fees := bc.TotalFees([]*Transaction{tx}); fees != 2 {
+		t.Fatalf("fees = %d, want 2", fees)
+	}
+
+	overpaying := nextBlock(t, bc, bc.tip, NewRewardTX(address, "", subsidy+3), tx)
+	if err := bc.AddBlock(overpaying); !errors.Is(err, ErrInvalidBlock) {
+		t.Errorf("coinbase paying more than the fees: got %v, want %v", err, ErrInvalidBlock)
+	}
+
+	block := nextBlock(t, bc, bc.tip, NewRewardTX(address, "", subsidy+2), tx)
+	if err := bc.AddBlock(block); err != nil {
+		t.Fatal(err)
+	}
+
+	balance := 0
+	for _, out := range UTXOSet.FindUTXO(HashPubKey(wallet.PublicKey)) {
+		balance += out.Value
+	}
+	// the change of the genesis reward plus the new reward
+	if want := subsidy - 5 - 2 + subsidy + 2; balance != want {
+		t.Errorf("balance = %d, want %d", balance, want)
+	}
+}
+
+func TestPaymentTransaction(t *testing.T) {
+	defer useTestDir(t)()
+
+	wallet := NewWallet()
+	bc, err := CreateBlockchain(string(wallet.GetAddress()), "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.Close()
+	UTXOSet := UTXOSet{bc}
+
+	bob := string(NewWallet().GetAddress())
+	carol := string(NewWallet().GetAddress())
+	for _, payments := range [][]Payment{
+		nil,
+		{{bob, 1}, {carol, 1}, {bob, 2}},
+		{{bob, 1}, {"1BadAddress", 1}},
+		{{bob, 0}},
+		{{bob, subsidy}, {carol, 1}},
+	} {
+		if _, err := NewPaymentTransaction(wallet, payments, 0, 0, nil, &UTXOSet); err == nil {
+			t.Errorf("payments %v: got a transaction, want an error", payments)
+		}
+	}
+
+	tx, err := NewPaymentTransaction(wallet, []Payment{{bob, 3}, {carol, 4}}, 1, 0, nil, &UTXOSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tx.Vout) != 3 || tx.Vout[2].Value != subsidy-3-4-1 {
+		t.Errorf("outputs = %v, want bob, carol and the change", tx.Vout)
+	}
+	if !bc.VerifyTransaction(tx) {
+		t.Error("the transaction doesn't verify")
+	}
+}
+
+func TestReadPayments(t *testing.T) {
+	defer useTestDir(t)()
+
+	bob := string(NewWallet().GetAddress())
+	carol := string(NewWallet().GetAddress())
+	want := []Payment{{bob, 3}, {carol, 4}}
+
+	files := map[string]string{
+		"payouts.csv":  "address,amount\n" + bob + ",3\n" + carol + ", 4\n",
+		"payouts.json": `[{"address": "` + bob + `", "amount": 3}, {"address": "` + carol + `", "amount": 4}]`,
+	}
+	for file, content := range files {
+		err := ioutil.WriteFile(file, []byte(content), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		payments, err := readPayments(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(payments, want) {
+			t.Errorf("%s: payments = %v, want %v", file, payments, want)
+		}
+	}
+}
+
+func TestRejectInvalidOutputValues(t *testing.T) {
+	defer useTestDir(t)()
+
+	wallet := NewWallet()
+	address := string(wallet.GetAddress())
+	bc, err := CreateBlockchain(address, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.Close()
+
+	// a negative output would let the coinbase pay more than the reward with its other outputs
+	coinbase := NewRewardTX(address, "", 1000)
+	coinbase.Vout = append(coinbase.Vout, TxOutput{-990, HashPubKey(wallet.PublicKey), false, nil})
+	coinbase.ID = coinbase.Hash()
+	if err := bc.AddBlock(nextBlock(t, bc, bc.tip, coinbase)); !errors.Is(err, ErrInvalidBlock) {
+		t.Errorf("coinbase with a negative output: got %v, want %v", err, ErrInvalidBlock)
+	}
+
+	// outputs whose sum wraps around to the value of the input
+	genesis, err := bc.GetBlock(bc.tip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := spendOutput(bc, wallet, genesis.Transactions[0].ID, 0, subsidy, address)
+	tx.Vout = []TxOutput{*NewTxOutput(math.MaxInt64, address), *NewTxOutput(math.MaxInt64, address), *NewTxOutput(2, address)}
+	bc.SignTransaction(tx, wallet.PrivateKey)
+	tx.ID = tx.Hash()
+	if _, err := bc.TransactionFee(tx); err == nil {
+		t.Error("the outputs overflowing the input have a fee")
+	}
+	if err := NewMempool(bc).Add(tx); !errors.Is(err, ErrInvalidTransaction) {
+		t.Errorf("pooling the overflowing transaction: got %v, want %v", err, ErrInvalidTransaction)
+	}
+	if err := bc.AddBlock(nextBlock(t, bc, bc.tip, NewCoinbaseTX(address, ""), tx)); !errors.Is(err, ErrInvalidBlock) {
+		t.Errorf("block with the overflowing transaction: got %v, want %v", err, ErrInvalidBlock)
+	}
+	if balance := balanceOf(bc, wallet); balance != subsidy {
+		t.Errorf("balance = %d, want %d", balance, subsidy)
+	}
+}
+
+func TestTransactionString(t *testing.T) {
+	alice := string(NewWallet().GetAddress())
+	bob := string(NewWallet().GetAddress())
+	tx := Transaction{nil, []TxInput{{Txid: []byte{0xab, 0xcd}, Vout: 1}}, []TxOutput{*NewTxOutput(7, bob), *NewTxOutput(3, alice)}, 0}
+	tx.ID = tx.Hash()
+
+	want := fmt.Sprintf("--- Transaction %x:\n     Input 0: abcd:1\n     Output 0: 7 to %s\n     Output 1: 3 to %s", tx.ID, bob, alice)
+	if got := tx.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+	if got := NewCoinbaseTX(alice, "").String(); !strings.Contains(got, "Input 0: coinbase") {
+		t.Errorf("coinbase input is shown as\n%s", got)
+	}
+}
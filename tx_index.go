@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/boltdb/bolt"
+)
+
+const txIndexBucket = "txindex"
+
+// ErrTransactionNotFound is returned when a transaction isn't in the chain
+var ErrTransactionNotFound = errors.New("Transaction is not found")
+
+// TxLocation tells where a transaction of the main chain is stored, the block and its position in the block
+type TxLocation struct {
+	BlockHash []byte
+	Index     int
+}
+
+// Serialize converts a TxLocation into bytes
+func (l TxLocation) Serialize() []byte {
+	var buff bytes.Buffer
+
+	enc := gob.NewEncoder(&buff)
+	err := enc.Encode(l)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return buff.Bytes()
+}
+
+// DeserializeTxLocation converts bytes back into a TxLocation
+func DeserializeTxLocation(data []byte) TxLocation {
+	var l TxLocation
+
+	dec := gob.NewDecoder(bytes.NewReader(data))
+	err := dec.Decode(&l)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return l
+}
+
+// HasTxIndex tells whether the transaction index is enabled, it is kept up to date with the main chain once built
+func (bc *Blockchain) HasTxIndex() bool {
+	return bc.hasIndex(txIndexBucket)
+}
+
+// ReindexTransactions builds the transaction index from the blocks of the main chain, enabling it if needed
+func (bc *Blockchain) ReindexTransactions() error {
+	return bc.rebuildIndex(txIndexBucket, indexTransactions)
+}
+
+// FindTransactionBlock returns a transaction of the main chain along with the block including it
+// The transaction index is used when enabled, otherwise the chain is scanned from the tip
+func (bc *Blockchain) FindTransactionBlock(ID []byte) (Transaction, *Block, error) {
+	return bc.findTransactionBlockFrom(bc.tip, ID)
+}
+
+// findTransactionBlockFrom looks for a transaction in the branch ending with the block of hash from
+// The index only covers the main chain, so it is only used when from is on the main chain
+func (bc *Blockchain) findTransactionBlockFrom(from []byte, ID []byte) (Transaction, *Block, error) {
+	var block *Block
+	var found *Transaction
+	indexed := false
+
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		t := tx.Bucket([]byte(txIndexBucket))
+		if t == nil {
+			return nil
+		}
+
+		b := tx.Bucket([]byte(blocksBucket))
+		blockData := b.Get(from)
+		if blockData == nil {
+			return fmt.Errorf("%w: %x", ErrBlockNotFound, from)
+		}
+		fromBlock := DeserializeBlock(blockData)
+		if bytes.Compare(tx.Bucket([]byte(heightsBucket)).Get(IntToHex(int64(fromBlock.Height))), from) != 0 {
+			return nil
+		}
+		indexed = true
+
+		locationData := t.Get(ID)
+		if locationData == nil {
+			return nil
+		}
+		location := DeserializeTxLocation(locationData)
+		block = DeserializeBlock(b.Get(location.BlockHash))
+		// transactions of blocks above from are not in its branch yet
+		if block.Height <= fromBlock.Height {
+			found = block.Transactions[location.Index]
+		}
+
+		return nil
+	})
+	if err != nil {
+		return Transaction{}, nil, err
+	}
+
+	if indexed {
+		if found == nil {
+			return Transaction{}, nil, ErrTransactionNotFound
+		}
+		return *found, block, nil
+	}
+
+	bci := &BlockchainIterator{from, bc.db}
+
+	for {
+		block := bci.Next()
+
+		for _, tx := range block.Transactions {
+			if bytes.Compare(tx.ID, ID) == 0 {
+				return *tx, block, nil
+			}
+		}
+
+		if len(block.PrevBlockHash) == 0 {
+			break
+		}
+	}
+	return Transaction{}, nil, ErrTransactionNotFound
+}
+
+// indexTransactions adds the transactions of a block joining the main chain to the index
+func indexTransactions(t *bolt.Bucket, block *Block) error {
+	for i, tx := range block.Transactions {
+		err := t.Put(tx.ID, TxLocation{block.Hash, i}.Serialize())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unindexTransactions removes the transactions of a block leaving the main chain from the index
+func unindexTransactions(t *bolt.Bucket, block *Block) error {
+	for _, tx := range block.Transactions {
+		err := t.Delete(tx.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestTxIndexFollowsTheMainChain(t *testing.T) {
+	defer useTestDir(t)()
+
+	wallet := NewWallet()
+	address := string(wallet.GetAddress())
+	bc, err := CreateBlockchain(address, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.Close()
+
+	genesis := bc.tip
+	old := bc.MineBlock([]*Transaction{NewCoinbaseTX(address, "")})
+
+	err = bc.ReindexTransactions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bc.HasTxIndex() {
+		t.Fatal("transaction index is not enabled")
+	}
+
+	// the index is updated as blocks are mined
+	tx := NewUTXOTransaction(wallet, address, 3, 1, &UTXOSet{bc})
+	mined := bc.MineBlock([]*Transaction{NewRewardTX(address, "", subsidy+1), tx})
+
+	found, block, err := bc.FindTransactionBlock(tx.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(found.ID, tx.ID) || !bytes.Equal(block.Hash, mined.Hash) {
+		t.Errorf("found transaction %x in block %x, want %x in %x", found.ID, block.Hash, tx.ID, mined.Hash)
+	}
+
+	// a longer branch from the genesis block drops the transactions of the old branch
+	var branch []*Block
+	parent := genesis
+	for i := 0; i < 3; i++ {
+		block := nextBlock(t, bc, parent, NewCoinbaseTX(address, ""))
+		if err := bc.AddBlock(block); err != nil {
+			t.Fatal(err)
+		}
+		branch = append(branch, block)
+		parent = block.Hash
+	}
+	first, second, third := branch[0], branch[1], branch[2]
+
+	for _, gone := range [][]byte{tx.ID, old.Transactions[0].ID} {
+		if _, _, err := bc.FindTransactionBlock(gone); !errors.Is(err, ErrTransactionNotFound) {
+			t.Errorf("transaction %x of the old branch: got %v, want %v", gone, err, ErrTransactionNotFound)
+		}
+	}
+	_, block, err = bc.FindTransactionBlock(second.Transactions[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(block.Hash, second.Hash) {
+		t.Errorf("coinbase of block %x found in %x", second.Hash, block.Hash)
+	}
+
+	// transactions above the block the lookup starts from are not in its branch
+	if _, err := bc.findTransactionFrom(first.Hash, third.Transactions[0].ID); !errors.Is(err, ErrTransactionNotFound) {
+		t.Errorf("transaction above the starting block: got %v, want %v", err, ErrTransactionNotFound)
+	}
+}
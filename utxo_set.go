@@ -1 +1,412 @@
 package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/boltdb/bolt"
+	"log"
+	"sort"
+)
+
+const utxoBucket = "chainstate"
+const undoBucket = "undo"
+
+// SpentOutput is an output spent by a block, kept to put it back if the block is disconnected
+type SpentOutput struct {
+	Txid   []byte
+	Vout   int
+	Output TxOutput
+}
+
+// BlockUndo holds what is needed to disconnect a block of the main chain from the UTXO set
+type BlockUndo struct {
+	Spent []SpentOutput
+}
+
+// Serialize converts a BlockUndo into bytes
+func (u BlockUndo) Serialize() []byte {
+	var buff bytes.Buffer
+
+	enc := gob.NewEncoder(&buff)
+	err := enc.Encode(u)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return buff.Bytes()
+}
+
+// DeserializeBlockUndo converts bytes back into a BlockUndo
+func DeserializeBlockUndo(data []byte) BlockUndo {
+	var undo BlockUndo
+
+	dec := gob.NewDecoder(bytes.NewReader(data))
+	err := dec.Decode(&undo)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return undo
+}
+
+// ErrUTXONotIndexed is returned when the chainstate bucket is missing
+var ErrUTXONotIndexed = errors.New("UTXO set is not indexed, run reindexutxo")
+
+// UTXOSet is a cache of all unspent transaction outputs, stored in its own bucket
+// key - ID of a transaction, value - the unspent outputs of that transaction
+type UTXOSet struct {
+	Blockchain *Blockchain
+}
+
+// FindSpendable returns all unspent outputs locked with pubKeyHash, ordered by transaction ID and index
+func (u UTXOSet) FindSpendable(pubKeyHash []byte) []SpendableOutput {
+	var spendable []SpendableOutput
+	db := u.Blockchain.db
+
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(utxoBucket))
+		if b == nil {
+			return ErrUTXONotIndexed
+		}
+		c := b.Cursor()
+
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			outs := DeserializeOutputs(v)
+
+			var indexes []int
+			for outIdx, out := range outs.Outputs {
+				if out.IsLockedWithKey(pubKeyHash) {
+					indexes = append(indexes, outIdx)
+				}
+			}
+			sort.Ints(indexes)
+			for _, outIdx := range indexes {
+				spendable = append(spendable, SpendableOutput{append([]byte{}, k...), outIdx, outs.Outputs[outIdx].Value})
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return spendable
+}
+
+// FindSpendableOutputs finds and returns unspent outputs locked with pubKeyHash that can fullfil the amount
+// The outputs are picked by the default CoinSelector, all of them are returned when they don't cover amount
+func (u UTXOSet) FindSpendableOutputs(pubKeyHash []byte, amount int) (int, map[string][]int) {
+	unspentOutputs := make(map[string][]int)
+	accumulated := 0
+
+	spendable := u.FindSpendable(pubKeyHash)
+	selected, err := coinSelectors[defaultCoinSelector]().Select(spendable, amount)
+	if err != nil {
+		selected = spendable
+	}
+	for _, out := range selected {
+		txID := hex.EncodeToString(out.TxID)
+		accumulated += out.Value
+		unspentOutputs[txID] = append(unspentOutputs[txID], out.Vout)
+	}
+
+	return accumulated, unspentOutputs
+}
+
+// FindUTXO returns all unspent outputs locked with pubKeyHash
+func (u UTXOSet) FindUTXO(pubKeyHash []byte) []TxOutput {
+	var UTXOs []TxOutput
+	db := u.Blockchain.db
+
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(utxoBucket))
+		if b == nil {
+			return ErrUTXONotIndexed
+		}
+		c := b.Cursor()
+
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			outs := DeserializeOutputs(v)
+
+			for _, out := range outs.Outputs {
+				if out.IsLockedWithKey(pubKeyHash) {
+					UTXOs = append(UTXOs, out)
+				}
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return UTXOs
+}
+
+// CountTransactions returns the number of transactions in the UTXO set
+func (u UTXOSet) CountTransactions() int {
+	db := u.Blockchain.db
+	counter := 0
+
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(utxoBucket))
+		if b == nil {
+			return ErrUTXONotIndexed
+		}
+		c := b.Cursor()
+
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			counter++
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return counter
+}
+
+// UTXOStats summarizes the content of the UTXO set
+type UTXOStats struct {
+	Transactions int
+	Outputs      int
+	Supply       int
+}
+
+// Stats walks the UTXO set once and counts transactions, outputs and the total value they hold
+func (u UTXOSet) Stats() UTXOStats {
+	var stats UTXOStats
+	db := u.Blockchain.db
+
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(utxoBucket))
+		if b == nil {
+			return ErrUTXONotIndexed
+		}
+		c := b.Cursor()
+
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			outs := DeserializeOutputs(v)
+
+			stats.Transactions++
+			for _, out := range outs.Outputs {
+				stats.Outputs++
+				stats.Supply += out.Value
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return stats
+}
+
+// Reindex drops the UTXO bucket and rebuilds it from the blocks
+func (u UTXOSet) Reindex() {
+	u.ReindexWithProgress(nil)
+}
+
+// ReindexWithProgress rebuilds the UTXO bucket like Reindex, calling progress after every block scanned
+// The bucket is dropped and refilled within a single db transaction, so a crash leaves the old set untouched
+func (u UTXOSet) ReindexWithProgress(progress func(blocks int)) {
+	db := u.Blockchain.db
+	bucketName := []byte(utxoBucket)
+
+	UTXO := u.Blockchain.FindUTXOWithProgress(progress)
+
+	err := db.Update(func(tx *bolt.Tx) error {
+		err := tx.DeleteBucket(bucketName)
+		if err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+
+		b, err := tx.CreateBucket(bucketName)
+		if err != nil {
+			return err
+		}
+
+		for txID, outs := range UTXO {
+			key, err := hex.DecodeString(txID)
+			if err != nil {
+				return err
+			}
+			err = b.Put(key, outs.Serialize())
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+}
+
+// Update updates the UTXO set with transactions from the block
+// The block is considered to be the new tip of the blockchain
+func (u UTXOSet) Update(block *Block) {
+	err := u.Blockchain.db.Update(func(tx *bolt.Tx) error {
+		return u.connectBlock(tx, block)
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+}
+
+// connectBlock spends the outputs consumed by the block and adds the ones it creates
+// It fails if an input spends an output that isn't in the set, or if a transaction of the block has the ID of one
+// with unspent outputs, which would be overwritten. It records what was spent so disconnectBlock can undo it
+func (u UTXOSet) connectBlock(tx *bolt.Tx, block *Block) error {
+	b := tx.Bucket([]byte(utxoBucket))
+	if b == nil {
+		return ErrUTXONotIndexed
+	}
+	var undo BlockUndo
+
+	for _, t := range block.Transactions {
+		// remove the outputs consumed by the inputs, and drop the entry once nothing is left
+		if t.isCoinbase() == false {
+			for _, vin := range t.Vin {
+				outsBytes := b.Get(vin.Txid)
+				if outsBytes == nil {
+					return fmt.Errorf("Output %x:%d is not in the UTXO set", vin.Txid, vin.Vout)
+				}
+				updatedOuts := DeserializeOutputs(outsBytes)
+				out, ok := updatedOuts.Outputs[vin.Vout]
+				if !ok {
+					return fmt.Errorf("Output %x:%d is not in the UTXO set", vin.Txid, vin.Vout)
+				}
+				undo.Spent = append(undo.Spent, SpentOutput{vin.Txid, vin.Vout, out})
+				delete(updatedOuts.Outputs, vin.Vout)
+
+				if len(updatedOuts.Outputs) == 0 {
+					err := b.Delete(vin.Txid)
+					if err != nil {
+						return err
+					}
+				} else {
+					err := b.Put(vin.Txid, updatedOuts.Serialize())
+					if err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		if b.Get(t.ID) != nil {
+			return fmt.Errorf("Transaction %x already has unspent outputs", t.ID)
+		}
+		newOutputs := NewTxOutputs()
+		for outIdx, out := range t.Vout {
+			newOutputs.Outputs[outIdx] = out
+		}
+
+		err := b.Put(t.ID, newOutputs.Serialize())
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Bucket([]byte(undoBucket)).Put(block.Hash, undo.Serialize())
+}
+
+// disconnectBlock reverts connectBlock for the tip of the chain: the outputs created by the block are removed
+// and the outputs it spent are restored from its undo data
+func (u UTXOSet) disconnectBlock(tx *bolt.Tx, block *Block) error {
+	b := tx.Bucket([]byte(utxoBucket))
+	if b == nil {
+		return ErrUTXONotIndexed
+	}
+	undos := tx.Bucket([]byte(undoBucket))
+	undoData := undos.Get(block.Hash)
+	if undoData == nil {
+		return fmt.Errorf("%w: no undo data for block %x", ErrCorruptedDB, block.Hash)
+	}
+	undo := DeserializeBlockUndo(undoData)
+
+	created := make(map[string]bool)
+	for _, t := range block.Transactions {
+		err := b.Delete(t.ID)
+		if err != nil {
+			return err
+		}
+		created[hex.EncodeToString(t.ID)] = true
+	}
+
+	for _, spent := range undo.Spent {
+		// outputs created and spent within the block are gone with it
+		if created[hex.EncodeToString(spent.Txid)] {
+			continue
+		}
+		outs := NewTxOutputs()
+		if outsBytes := b.Get(spent.Txid); outsBytes != nil {
+			outs = DeserializeOutputs(outsBytes)
+		}
+		outs.Outputs[spent.Vout] = spent.Output
+
+		err := b.Put(spent.Txid, outs.Serialize())
+		if err != nil {
+			return err
+		}
+	}
+
+	return undos.Delete(block.Hash)
+}
+
+// HasOutputs tells whether the transaction txID has outputs in the UTXO set
+func (u UTXOSet) HasOutputs(txID []byte) bool {
+	found := false
+	db := u.Blockchain.db
+
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(utxoBucket))
+		if b == nil {
+			return ErrUTXONotIndexed
+		}
+
+		found = b.Get(txID) != nil
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return found
+}
+
+// IsUnspent tells whether the output vout of the transaction txID is in the UTXO set
+func (u UTXOSet) IsUnspent(txID []byte, vout int) bool {
+	found := false
+	db := u.Blockchain.db
+
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(utxoBucket))
+		if b == nil {
+			return ErrUTXONotIndexed
+		}
+
+		outsBytes := b.Get(txID)
+		if outsBytes == nil {
+			return nil
+		}
+		_, found = DeserializeOutputs(outsBytes).Outputs[vout]
+
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return found
+}
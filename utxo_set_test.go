@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/boltdb/bolt"
+)
+
+func TestFindSpendableOutputs(t *testing.T) {
+	defer useTestDir(t)()
+
+	wallet := NewWallet()
+	address := string(wallet.GetAddress())
+	bc, err := CreateBlockchain(address, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.Close()
+
+	mined := bc.MineBlock([]*Transaction{NewRewardTX(address, "", 2*subsidy)})
+	UTXOSet := UTXOSet{bc}
+	pubKeyHash := HashPubKey(wallet.PublicKey)
+
+	// the default selector spends the largest output first
+	accumulated, outputs := UTXOSet.FindSpendableOutputs(pubKeyHash, subsidy+1)
+	if accumulated != 2*subsidy || len(outputs) != 1 || len(outputs[hex.EncodeToString(mined.Transactions[0].ID)]) != 1 {
+		t.Errorf("found %d in %v, want the output of %x", accumulated, outputs, mined.Transactions[0].ID)
+	}
+
+	accumulated, outputs = UTXOSet.FindSpendableOutputs(pubKeyHash, 3*subsidy)
+	if accumulated != 3*subsidy || len(outputs) != 2 {
+		t.Errorf("found %d in %v, want both outputs", accumulated, outputs)
+	}
+
+	// outputs that don't cover the amount are all returned, the caller checks the total
+	accumulated, outputs = UTXOSet.FindSpendableOutputs(pubKeyHash, 4*subsidy)
+	if accumulated != 3*subsidy || len(outputs) != 2 {
+		t.Errorf("found %d in %v, want both outputs", accumulated, outputs)
+	}
+	if accumulated, outputs := UTXOSet.FindSpendableOutputs(HashPubKey(NewWallet().PublicKey), 1); accumulated != 0 || len(outputs) != 0 {
+		t.Errorf("found %d in %v for a wallet without outputs", accumulated, outputs)
+	}
+}
+
+func TestUTXOSetUpdate(t *testing.T) {
+	defer useTestDir(t)()
+
+	wallet, bob := NewWallet(), NewWallet()
+	address := string(wallet.GetAddress())
+	bc, err := CreateBlockchain(address, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.Close()
+
+	UTXOSet := UTXOSet{bc}
+	if n := UTXOSet.CountTransactions(); n != 1 {
+		t.Fatalf("%d transactions in the genesis UTXO set, want 1", n)
+	}
+	genesis, err := bc.GetBlock(bc.tip)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the payment spends the whole genesis reward, MineBlock updates the set with its block
+	tx := NewUTXOTransaction(wallet, string(bob.GetAddress()), 4, 1, &UTXOSet)
+	bc.MineBlock([]*Transaction{NewRewardTX(address, "", subsidy+1), tx})
+	if n := UTXOSet.CountTransactions(); n != 2 {
+		t.Errorf("%d transactions in the UTXO set, want the reward and the payment", n)
+	}
+	if UTXOSet.IsUnspent(genesis.Transactions[0].ID, 0) {
+		t.Error("the genesis reward is still unspent")
+	}
+	if balanceOf(bc, bob) != 4 || balanceOf(bc, wallet) != 2*subsidy-4 {
+		t.Errorf("balances: wallet %d, bob %d", balanceOf(bc, wallet), balanceOf(bc, bob))
+	}
+
+	// Update connects a block the same way
+	UTXOSet.Update(nextBlock(t, bc, bc.tip, NewCoinbaseTX(address, "")))
+	if n := UTXOSet.CountTransactions(); n != 3 {
+		t.Errorf("%d transactions in the UTXO set after Update, want 3", n)
+	}
+	if balance := balanceOf(bc, wallet); balance != 3*subsidy-4 {
+		t.Errorf("wallet balance after Update = %d, want %d", balance, 3*subsidy-4)
+	}
+}
+
+func TestReindexUTXORebuildsDeletedChainstate(t *testing.T) {
+	defer useTestDir(t)()
+
+	wallet := NewWallet()
+	address := string(wallet.GetAddress())
+	bc, err := CreateBlockchain(address, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	UTXOSet := UTXOSet{bc}
+	for i := 0; i < 3; i++ {
+		tx := NewUTXOTransaction(wallet, string(NewWallet().GetAddress()), 1, 1, &UTXOSet)
+		bc.MineBlock([]*Transaction{NewRewardTX(address, "", subsidy+1), tx})
+	}
+	before := UTXOSet.Stats()
+
+	err = bc.db.Update(func(tx *bolt.Tx) error {
+		return tx.DeleteBucket([]byte(utxoBucket))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc.Close()
+
+	cli := CLI{}
+	cli.reindexUTXO("")
+
+	bc, err = NewBlockchain("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.Close()
+	UTXOSet.Blockchain = bc
+	if after := UTXOSet.Stats(); after != before {
+		t.Errorf("stats after reindexutxo = %+v, want %+v", after, before)
+	}
+}
@@ -11,6 +11,9 @@ import (
 )
 
 const version = byte(0x00)
+
+// multisigVersion prefixes the addresses of M-of-N multisig policies
+const multisigVersion = byte(0x05)
 const walletFile = "wallet.dat"
 const addressCheckSumLen = 4
 
@@ -23,10 +26,18 @@ type Wallet struct {
 // GetAddress returns a wallet's address. The address is derived from public key
 func (w Wallet) GetAddress() []byte {
 	// double hashing the pub key
-	pubKeyHash := HashPubKey(w.PublicKey)
+	return PubKeyHashToAddress(HashPubKey(w.PublicKey))
+}
+
+// PubKeyHashToAddress returns the address of a public key hash
+func PubKeyHashToAddress(pubKeyHash []byte) []byte {
+	return hashToAddress(version, pubKeyHash)
+}
 
+// hashToAddress returns the address of a hash, its version telling what the hash is of
+func hashToAddress(addressVersion byte, hash []byte) []byte {
 	// prepend version
-	versionedPayload := append([]byte{version}, pubKeyHash...)
+	versionedPayload := append([]byte{addressVersion}, hash...)
 
 	// calculate the checksum
 	checksum := checksum(versionedPayload)
@@ -54,8 +65,17 @@ func newKeyPair() (ecdsa.PrivateKey, []byte) {
 	if err != nil {
 		log.Panic("Error generating ecdsa key")
 	}
-	pubKey := append(private.PublicKey.X.Bytes(), private.PublicKey.Y.Bytes()...)
-	return *private, pubKey
+	return *private, pubKeyBytes(private.PublicKey)
+}
+
+// pubKeyBytes returns the public key as stored in wallets and transaction inputs
+func pubKeyBytes(key ecdsa.PublicKey) []byte {
+	// both coordinates take the full size of the curve, so the key can be split back in half
+	keyLen := (key.Curve.Params().BitSize + 7) / 8
+	pubKey := make([]byte, 2*keyLen)
+	key.X.FillBytes(pubKey[:keyLen])
+	key.Y.FillBytes(pubKey[keyLen:])
+	return pubKey
 }
 
 // HashPubKey returns a double-hashed public key
@@ -74,14 +94,32 @@ func HashPubKey(pubKey []byte) []byte {
 
 // ValidateAddress validates an address
 func ValidateAddress(address string) bool {
+	for i := 0; i < len(address); i++ {
+		if bytes.IndexByte(b58Alphabet, address[i]) < 0 {
+			return false
+		}
+	}
 	pubKeyHash := Base58Decode([]byte(address))
+	if len(pubKeyHash) != 1+ripemd160.Size+addressCheckSumLen {
+		return false
+	}
 	actualChecksum := pubKeyHash[len(pubKeyHash)-addressCheckSumLen:]
-	version := pubKeyHash[0]
+	addressVersion := pubKeyHash[0]
+	if addressVersion != version && addressVersion != multisigVersion {
+		return false
+	}
 	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-addressCheckSumLen]
-	targetChecksum := checksum(append([]byte{version}, pubKeyHash...))
+	targetChecksum := checksum(append([]byte{addressVersion}, pubKeyHash...))
 
 	return bytes.Compare(actualChecksum, targetChecksum) == 0
 }
+
+// decodeAddress returns the version and the hash of a valid address
+func decodeAddress(address string) (byte, []byte) {
+	payload := Base58Decode([]byte(address))
+	return payload[0], payload[1 : len(payload)-addressCheckSumLen]
+}
+
 func checksum(payload []byte) []byte {
 	firstSHA := sha256.Sum256(payload)
 	secondSHA := sha256.Sum256(firstSHA[:])
@@ -2,23 +2,112 @@ package main
 
 import (
 	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
 	"crypto/elliptic"
+	"crypto/rand"
 	"encoding/gob"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"math/big"
 	"os"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// verifierData is authenticated by the verifier of an encrypted wallet file
+var verifierData = []byte("glockchain wallet")
+
+// seedData is authenticated along with the encrypted HD seed
+var seedData = []byte("hd seed")
+
+// walletFileVersion is the format of the wallet file, files without a version are the legacy gob of Wallets
+// Version 3 adds the HD seed, version 4 watch-only addresses and version 5 multisig policies, older files are
+// read as wallets without them
+const walletFileVersion = 5
+
+// hdGapLimit is how many unused addresses in a row end the search for used addresses when restoring a seed
+const hdGapLimit = 20
+
+// scrypt cost parameters used to derive the encryption key from a passphrase
+const (
+	scryptN      = 1 << 15
+	scryptR      = 8
+	scryptP      = 1
+	scryptKeyLen = 32
+	saltLen      = 16
+)
+
+var (
+	// ErrWalletNotFound is returned when the wallet file has no key for an address
+	ErrWalletNotFound = errors.New("Address is not in the wallet file")
+	// ErrWalletLocked is returned when a private key is needed from an encrypted wallet that isn't unlocked
+	ErrWalletLocked = errors.New("Wallet is encrypted, unlock it with the passphrase first")
+	// ErrWalletEncrypted is returned when encrypting a wallet that already is
+	ErrWalletEncrypted = errors.New("Wallet is already encrypted")
+	// ErrWalletNotEncrypted is returned when changing the passphrase of a wallet that has none
+	ErrWalletNotEncrypted = errors.New("Wallet is not encrypted")
+	// ErrWrongPassphrase is returned when a passphrase doesn't decrypt the wallet
+	ErrWrongPassphrase = errors.New("The passphrase is incorrect")
+	// ErrWalletHasSeed is returned when giving a seed to a wallet that already has one
+	ErrWalletHasSeed = errors.New("Wallet already has a seed")
+	// ErrKeyExists is returned when importing a key the wallet file already has
+	ErrKeyExists = errors.New("Key is already in the wallet file")
+	// ErrAddressExists is returned when watching an address the wallet file already has
+	ErrAddressExists = errors.New("Address is already in the wallet file")
+	// ErrWatchOnly is returned when a private key is needed for a watch-only address
+	ErrWatchOnly = errors.New("Address is watch-only, the wallet has no private key for it")
 )
 
 // Wallets holds many Wallet, identified by their addresses
+// Keys of an encrypted wallet stay in locked until Unlock decrypts them into Wallets.
+// Addresses of a wallet with a seed are derived from it, nextIndex is the index of the next one.
+// watched are the watch-only addresses, with their public key when it is known, and multisig the policies of
+// multisig addresses, whose keys belong to other wallets
 type Wallets struct {
-	Wallets map[string]*Wallet
+	Wallets  map[string]*Wallet
+	watched  map[string][]byte
+	multisig map[string]*Multisig
+
+	locked     map[string]storedKey
+	salt       []byte    // nil unless the wallet is encrypted
+	verifier   storedKey // encrypts nothing, checks the passphrase even without keys
+	key        []byte    // derived from the passphrase and salt, once unlocked
+	seed       []byte    // nil unless the wallet has a seed and is unlocked
+	lockedSeed storedKey // the encrypted seed, until Unlock decrypts it
+	nextIndex  int
+}
+
+// walletFileContent is what the wallet file stores
+type walletFileContent struct {
+	Version   int
+	Salt      []byte
+	Verifier  storedKey
+	Keys      map[string]storedKey
+	Seed      storedKey
+	NextIndex int
+	Watched   map[string][]byte
+	Multisig  map[string]*Multisig
+}
+
+// storedKey is a key pair of the wallet file
+// PrivateKey is the private scalar, encrypted with AES-GCM under the passphrase key when Nonce is set
+type storedKey struct {
+	PublicKey  []byte
+	PrivateKey []byte
+	Nonce      []byte
 }
 
 // NewWallets creates wallets and fills it from a file if it exists
 func NewWallets() (*Wallets, error) {
 	wallets := Wallets{}
 	wallets.Wallets = make(map[string]*Wallet)
+	wallets.locked = make(map[string]storedKey)
+	wallets.watched = make(map[string][]byte)
+	wallets.multisig = make(map[string]*Multisig)
 
 	err := wallets.LoadFromFile()
 
@@ -26,31 +115,326 @@ func NewWallets() (*Wallets, error) {
 }
 
 // CreateWallet create a new wallet and add it to wallets
-func (ws *Wallets) CreateWallet() string {
-	wallet := NewWallet()
+// The key is the next one derived from the seed, or a random one when the wallet has no seed.
+// An encrypted wallet must be unlocked, so the new key can be encrypted too
+func (ws *Wallets) CreateWallet() (string, error) {
+	if ws.IsEncrypted() && ws.key == nil {
+		return "", ErrWalletLocked
+	}
+
+	var wallet *Wallet
+	if ws.seed != nil {
+		wallet = hdAddressKey(ws.seed, ws.nextIndex).Wallet()
+		ws.nextIndex++
+	} else {
+		wallet = NewWallet()
+	}
 	address := fmt.Sprintf("%s", wallet.GetAddress())
 	ws.Wallets[address] = wallet
 
-	return address
+	return address, nil
 }
 
-// GetAddresses return a list of addresses of wallets
+// ImportWallet adds the key pair of wallet, which doesn't derive from the seed, and returns its address
+func (ws *Wallets) ImportWallet(wallet *Wallet) (string, error) {
+	address := fmt.Sprintf("%s", wallet.GetAddress())
+	if _, ok := ws.Wallets[address]; ok {
+		return "", fmt.Errorf("%w: %s", ErrKeyExists, address)
+	}
+	if _, ok := ws.locked[address]; ok {
+		return "", fmt.Errorf("%w: %s", ErrKeyExists, address)
+	}
+	if ws.IsEncrypted() && ws.key == nil {
+		return "", ErrWalletLocked
+	}
+
+	// the key of a watched address turns it into a full one
+	delete(ws.watched, address)
+	ws.Wallets[address] = wallet
+	return address, nil
+}
+
+// WatchAddress adds an address the wallet tracks without its private key
+func (ws *Wallets) WatchAddress(address string) error {
+	if !ValidateAddress(address) {
+		return fmt.Errorf("Address is not valid: %s", address)
+	}
+	return ws.watch(address, nil)
+}
+
+// WatchPublicKey adds the address of a public key, which the wallet tracks without its private key
+func (ws *Wallets) WatchPublicKey(pubKey []byte) (string, error) {
+	curve := elliptic.P256()
+	keyLen := (curve.Params().BitSize + 7) / 8
+	if len(pubKey) != 2*keyLen || !curve.IsOnCurve(new(big.Int).SetBytes(pubKey[:keyLen]), new(big.Int).SetBytes(pubKey[keyLen:])) {
+		return "", errors.New("Public key is not valid")
+	}
+
+	address := string(PubKeyHashToAddress(HashPubKey(pubKey)))
+	return address, ws.watch(address, pubKey)
+}
+
+func (ws *Wallets) watch(address string, pubKey []byte) error {
+	if ws.hasAddress(address) {
+		return fmt.Errorf("%w: %s", ErrAddressExists, address)
+	}
+	ws.watched[address] = pubKey
+	return nil
+}
+
+// hasAddress tells whether address is in the wallet file, with its key or not
+func (ws *Wallets) hasAddress(address string) bool {
+	_, watched := ws.watched[address]
+	_, unlocked := ws.Wallets[address]
+	_, locked := ws.locked[address]
+	_, multisig := ws.multisig[address]
+	return watched || unlocked || locked || multisig
+}
+
+// AddMultisig adds the policy of a multisig address, so the wallet can build transactions spending from it
+func (ws *Wallets) AddMultisig(policy *Multisig) (string, error) {
+	err := policy.check()
+	if err != nil {
+		return "", err
+	}
+	address := fmt.Sprintf("%s", policy.Address())
+	if ws.hasAddress(address) {
+		return "", fmt.Errorf("%w: %s", ErrAddressExists, address)
+	}
+
+	ws.multisig[address] = policy
+	return address, nil
+}
+
+// GetMultisig returns the policy of a multisig address of the wallet
+func (ws *Wallets) GetMultisig(address string) (*Multisig, error) {
+	if policy, ok := ws.multisig[address]; ok {
+		return policy, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrWalletNotFound, address)
+}
+
+// GetMultisigAddresses returns the multisig addresses of the wallet
+func (ws *Wallets) GetMultisigAddresses() []string {
+	var addresses []string
+	for address := range ws.multisig {
+		addresses = append(addresses, address)
+	}
+	return addresses
+}
+
+// IsWatchOnly tells whether address is tracked by the wallet without its private key
+func (ws *Wallets) IsWatchOnly(address string) bool {
+	_, ok := ws.watched[address]
+	return ok
+}
+
+// GetWatchOnlyAddresses returns the addresses the wallet tracks without their private keys
+func (ws *Wallets) GetWatchOnlyAddresses() []string {
+	var addresses []string
+	for address := range ws.watched {
+		addresses = append(addresses, address)
+	}
+	return addresses
+}
+
+// HasSeed tells whether the addresses of the wallet are derived from a seed
+func (ws *Wallets) HasSeed() bool {
+	return ws.seed != nil || ws.lockedSeed.PrivateKey != nil
+}
+
+// NewSeed gives the wallet a random seed, the returned mnemonic is the only way to restore it
+func (ws *Wallets) NewSeed() (string, error) {
+	mnemonic, err := NewMnemonic()
+	if err != nil {
+		return "", err
+	}
+	return mnemonic, ws.setSeed(mnemonic)
+}
+
+// RestoreSeed gives the wallet the seed of mnemonic and derives its addresses again
+// Addresses are derived until hdGapLimit of them in a row aren't used, used tells whether a public key hash
+// has any activity. The restored addresses are returned, the last one being the last used address
+func (ws *Wallets) RestoreSeed(mnemonic string, used func(pubKeyHash []byte) bool) ([]string, error) {
+	err := ws.setSeed(mnemonic)
+	if err != nil {
+		return nil, err
+	}
+
+	chain := NewMasterKey(ws.seed).Derive(hdAddressPath...)
+	var wallets []*Wallet
+	for index, unused := 0, 0; unused < hdGapLimit; index++ {
+		wallet := chain.Child(uint32(index)).Wallet()
+		wallets = append(wallets, wallet)
+		unused++
+		if used(HashPubKey(wallet.PublicKey)) {
+			unused = 0
+			ws.nextIndex = index + 1
+		}
+	}
+
+	var addresses []string
+	for _, wallet := range wallets[:ws.nextIndex] {
+		address := fmt.Sprintf("%s", wallet.GetAddress())
+		ws.Wallets[address] = wallet
+		addresses = append(addresses, address)
+	}
+	return addresses, nil
+}
+
+func (ws *Wallets) setSeed(mnemonic string) error {
+	if ws.HasSeed() {
+		return ErrWalletHasSeed
+	}
+	if ws.IsEncrypted() && ws.key == nil {
+		return ErrWalletLocked
+	}
+
+	seed, err := MnemonicToSeed(mnemonic, "")
+	if err != nil {
+		return err
+	}
+	ws.seed = seed
+	ws.nextIndex = 0
+	return nil
+}
+
+// GetAddresses return a list of addresses of wallets, watch-only addresses excluded
 func (ws *Wallets) GetAddresses() []string {
 	var addresses []string
 
 	for address := range ws.Wallets {
 		addresses = append(addresses, address)
 	}
+	for address := range ws.locked {
+		addresses = append(addresses, address)
+	}
 
 	return addresses
 }
 
 // GetWallet return a wallet from wallets
-func (ws Wallets) GetWallet(address string) Wallet {
-	return *ws.Wallets[address]
+func (ws Wallets) GetWallet(address string) (*Wallet, error) {
+	if wallet, ok := ws.Wallets[address]; ok {
+		return wallet, nil
+	}
+	if _, ok := ws.locked[address]; ok {
+		return nil, ErrWalletLocked
+	}
+	if _, ok := ws.watched[address]; ok {
+		return nil, fmt.Errorf("%w: %s", ErrWatchOnly, address)
+	}
+	return nil, fmt.Errorf("%w: %s", ErrWalletNotFound, address)
+}
+
+// GetPublicKey returns the public key of an address of the wallet, it is known even while the wallet is locked
+// and for watch-only addresses added by public key
+func (ws *Wallets) GetPublicKey(address string) ([]byte, error) {
+	if wallet, ok := ws.Wallets[address]; ok {
+		return wallet.PublicKey, nil
+	}
+	if stored, ok := ws.locked[address]; ok {
+		return stored.PublicKey, nil
+	}
+	if pubKey := ws.watched[address]; pubKey != nil {
+		return pubKey, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrWalletNotFound, address)
+}
+
+// IsEncrypted tells whether the private keys are encrypted with a passphrase
+func (ws *Wallets) IsEncrypted() bool {
+	return ws.salt != nil
+}
+
+// Unlock decrypts the private keys of an encrypted wallet with its passphrase
+func (ws *Wallets) Unlock(passphrase string) error {
+	if !ws.IsEncrypted() {
+		return nil
+	}
+
+	key, err := deriveWalletKey(passphrase, ws.salt)
+	if err != nil {
+		return err
+	}
+	err = ws.verifier.verify(key)
+	if err != nil {
+		return err
+	}
+
+	wallets := make(map[string]*Wallet)
+	for address, stored := range ws.locked {
+		wallet, err := stored.open(key, address)
+		if err != nil {
+			return err
+		}
+		wallets[address] = wallet
+	}
+	var seed []byte
+	if ws.lockedSeed.PrivateKey != nil {
+		seed, err = ws.lockedSeed.decrypt(key, seedData)
+		if err != nil {
+			return err
+		}
+	}
+
+	for address, wallet := range wallets {
+		ws.Wallets[address] = wallet
+		delete(ws.locked, address)
+	}
+	if seed != nil {
+		ws.seed = seed
+		ws.lockedSeed = storedKey{}
+	}
+	ws.key = key
+
+	return nil
+}
+
+// Encrypt protects the private keys with a passphrase, they are encrypted when the wallet is saved
+func (ws *Wallets) Encrypt(passphrase string) error {
+	if ws.IsEncrypted() {
+		return ErrWalletEncrypted
+	}
+	return ws.setPassphrase(passphrase)
+}
+
+// ChangePassphrase encrypts the private keys with a new passphrase once the old one unlocks them
+func (ws *Wallets) ChangePassphrase(oldPassphrase, newPassphrase string) error {
+	if !ws.IsEncrypted() {
+		return ErrWalletNotEncrypted
+	}
+	err := ws.Unlock(oldPassphrase)
+	if err != nil {
+		return err
+	}
+	return ws.setPassphrase(newPassphrase)
+}
+
+func (ws *Wallets) setPassphrase(passphrase string) error {
+	salt := make([]byte, saltLen)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return err
+	}
+
+	key, err := deriveWalletKey(passphrase, salt)
+	if err != nil {
+		return err
+	}
+	verifier, err := seal(nil, key, verifierData)
+	if err != nil {
+		return err
+	}
+
+	ws.salt = salt
+	ws.verifier = verifier
+	ws.key = key
+	return nil
 }
 
 // LoadFromFile loads wallets from file
+// A file in the legacy format, a plain gob of Wallets, is rewritten in the current format
 func (ws *Wallets) LoadFromFile() error {
 	if _, err := os.Stat(walletFile); os.IsNotExist(err) {
 		return err
@@ -58,34 +442,205 @@ func (ws *Wallets) LoadFromFile() error {
 
 	fileContent, err := ioutil.ReadFile(walletFile)
 	if err != nil {
-		log.Panic(err)
+		return err
+	}
+
+	var content walletFileContent
+	err = gob.NewDecoder(bytes.NewReader(fileContent)).Decode(&content)
+	if err != nil || content.Version == 0 {
+		err = ws.loadLegacy(fileContent)
+		if err != nil {
+			return err
+		}
+		return ws.SaveToFile()
+	}
+	if content.Version > walletFileVersion {
+		return fmt.Errorf("Wallet file version %d is not supported", content.Version)
+	}
+
+	ws.salt = content.Salt
+	ws.verifier = content.Verifier
+	ws.nextIndex = content.NextIndex
+	for address, pubKey := range content.Watched {
+		ws.watched[address] = pubKey
+	}
+	for address, policy := range content.Multisig {
+		ws.multisig[address] = policy
+	}
+	if ws.IsEncrypted() {
+		ws.lockedSeed = content.Seed
+	} else {
+		ws.seed = content.Seed.PrivateKey
+	}
+	for address, stored := range content.Keys {
+		if ws.IsEncrypted() {
+			ws.locked[address] = stored
+			continue
+		}
+		wallet, err := stored.open(nil, address)
+		if err != nil {
+			return err
+		}
+		ws.Wallets[address] = wallet
+	}
+
+	return nil
+}
+
+// legacyWallets mirrors the legacy wallet file, only the private scalar and public key of each wallet are read
+type legacyWallets struct {
+	Wallets map[string]*struct {
+		PrivateKey struct {
+			D *big.Int
+		}
+		PublicKey []byte
 	}
+}
+
+func (ws *Wallets) loadLegacy(fileContent []byte) error {
+	var legacy legacyWallets
 
-	var wallets Wallets
-	gob.Register(elliptic.P256())
-	decoder := gob.NewDecoder(bytes.NewReader(fileContent))
-	err = decoder.Decode(&wallets)
+	err := gob.NewDecoder(bytes.NewReader(fileContent)).Decode(&legacy)
 	if err != nil {
-		log.Panic(err)
+		return fmt.Errorf("Wallet file is not readable: %v", err)
 	}
-	ws.Wallets = wallets.Wallets
+
+	for address, wallet := range legacy.Wallets {
+		ws.Wallets[address] = &Wallet{privateKeyFromD(wallet.PrivateKey.D), wallet.PublicKey}
+	}
+
 	return nil
 }
 
 // SaveToFile save wallets to dat file
-func (ws Wallets) SaveToFile() {
-	var content bytes.Buffer
+// The file is only readable by its owner, and the private keys are encrypted if the wallet is
+func (ws Wallets) SaveToFile() error {
+	content := walletFileContent{walletFileVersion, ws.salt, ws.verifier, make(map[string]storedKey), ws.lockedSeed, ws.nextIndex, ws.watched, ws.multisig}
+
+	if ws.seed != nil {
+		if ws.IsEncrypted() && ws.key == nil {
+			return ErrWalletLocked
+		}
+		seed, err := seal(ws.seed, ws.key, seedData)
+		if err != nil {
+			return err
+		}
+		content.Seed = seed
+	}
+
+	for address, stored := range ws.locked {
+		content.Keys[address] = stored
+	}
+	for address, wallet := range ws.Wallets {
+		if ws.IsEncrypted() && ws.key == nil {
+			return ErrWalletLocked
+		}
+		stored, err := sealKey(wallet, ws.key, address)
+		if err != nil {
+			return err
+		}
+		content.Keys[address] = stored
+	}
+
+	var buff bytes.Buffer
+	err := gob.NewEncoder(&buff).Encode(content)
+	if err != nil {
+		return err
+	}
+
+	// write a new file and move it over the old one, so a crash doesn't leave a truncated wallet behind
+	tmpFile := walletFile + ".tmp"
+	err = ioutil.WriteFile(tmpFile, buff.Bytes(), 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, walletFile)
+}
+
+// sealKey prepares a wallet for the wallet file, encrypting its private key when key is set
+func sealKey(wallet *Wallet, key []byte, address string) (storedKey, error) {
+	d := make([]byte, (wallet.PrivateKey.Curve.Params().BitSize+7)/8)
+	wallet.PrivateKey.D.FillBytes(d)
+
+	stored, err := seal(d, key, []byte(address))
+	stored.PublicKey = wallet.PublicKey
+	return stored, err
+}
+
+// seal encrypts data with key, authenticating ad along with it, and leaves data as it is without a key
+// The address is used as ad for private keys, so keys can't be swapped between addresses
+func seal(data, key, ad []byte) (storedKey, error) {
+	if key == nil {
+		return storedKey{PrivateKey: data}, nil
+	}
 
-	gob.Register(elliptic.P256())
+	gcm, err := newWalletCipher(key)
+	if err != nil {
+		return storedKey{}, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return storedKey{}, err
+	}
+
+	return storedKey{PrivateKey: gcm.Seal(nil, nonce, data, ad), Nonce: nonce}, nil
+}
 
-	encoder := gob.NewEncoder(&content)
-	err := encoder.Encode(ws)
+// open turns a key of the wallet file back into a wallet, decrypting it with key when it is encrypted
+func (k storedKey) open(key []byte, address string) (*Wallet, error) {
+	d, err := k.decrypt(key, []byte(address))
 	if err != nil {
-		log.Panic(err)
+		return nil, err
 	}
 
-	err = ioutil.WriteFile(walletFile, content.Bytes(), 0644)
+	return &Wallet{privateKeyFromD(new(big.Int).SetBytes(d)), k.PublicKey}, nil
+}
+
+// verify checks that key decrypts the verifier of the wallet file
+func (k storedKey) verify(key []byte) error {
+	_, err := k.decrypt(key, verifierData)
+	return err
+}
+
+func (k storedKey) decrypt(key, ad []byte) ([]byte, error) {
+	if k.Nonce == nil {
+		return k.PrivateKey, nil
+	}
+	if key == nil {
+		return nil, ErrWalletLocked
+	}
+
+	gcm, err := newWalletCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := gcm.Open(nil, k.Nonce, k.PrivateKey, ad)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return data, nil
+}
+
+func newWalletCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
 	if err != nil {
-		log.Panic(err)
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// deriveWalletKey derives the AES key of the wallet file from a passphrase
+func deriveWalletKey(passphrase string, salt []byte) ([]byte, error) {
+	return scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, scryptKeyLen)
+}
+
+// privateKeyFromD rebuilds a P-256 private key from its private scalar
+func privateKeyFromD(d *big.Int) ecdsa.PrivateKey {
+	curve := elliptic.P256()
+	x, y := curve.ScalarBaseMult(d.Bytes())
+	if x == nil {
+		log.Panic("Error rebuilding a private key")
 	}
+	return ecdsa.PrivateKey{PublicKey: ecdsa.PublicKey{Curve: curve, X: x, Y: y}, D: d}
 }
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+)
+
+func TestEncryptedWalletFile(t *testing.T) {
+	defer useTestDir(t)()
+
+	wallets, _ := NewWallets()
+	address, err := wallets.CreateWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	original, _ := wallets.GetWallet(address)
+	err = wallets.Encrypt("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = wallets.SaveToFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(walletFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("wallet file mode = %v, want 0600", info.Mode().Perm())
+	}
+	content, err := ioutil.ReadFile(walletFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(content, original.PrivateKey.D.Bytes()) {
+		t.Error("the wallet file contains the private key in clear")
+	}
+
+	// a locked wallet lists its addresses but doesn't give its keys
+	wallets, err = NewWallets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addresses := wallets.GetAddresses(); len(addresses) != 1 || addresses[0] != address {
+		t.Errorf("addresses = %v, want %s", addresses, address)
+	}
+	if _, err := wallets.GetWallet(address); !errors.Is(err, ErrWalletLocked) {
+		t.Errorf("key of a locked wallet: got %v, want %v", err, ErrWalletLocked)
+	}
+	if _, err := wallets.CreateWallet(); !errors.Is(err, ErrWalletLocked) {
+		t.Errorf("new key in a locked wallet: got %v, want %v", err, ErrWalletLocked)
+	}
+	if err := wallets.Unlock("wrong horse"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("unlock with a wrong passphrase: got %v, want %v", err, ErrWrongPassphrase)
+	}
+
+	err = wallets.ChangePassphrase("correct horse", "battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = wallets.SaveToFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wallets, err = NewWallets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wallets.Unlock("correct horse"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("unlock with the old passphrase: got %v, want %v", err, ErrWrongPassphrase)
+	}
+	err = wallets.Unlock("battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wallet, err := wallets.GetWallet(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wallet.PrivateKey.D.Cmp(original.PrivateKey.D) != 0 || !bytes.Equal(wallet.GetAddress(), []byte(address)) {
+		t.Error("the decrypted key isn't the original one")
+	}
+}
+
+// legacyCurve stands for the curve the legacy wallet file gob-encoded with every key
+type legacyCurve struct {
+	Name string
+}
+
+func TestLegacyWalletFileIsMigrated(t *testing.T) {
+	defer useTestDir(t)()
+
+	type legacyPublicKey struct {
+		Curve interface{}
+		X, Y  *big.Int
+	}
+	type legacyPrivateKey struct {
+		PublicKey legacyPublicKey
+		D         *big.Int
+	}
+	type legacyWallet struct {
+		PrivateKey legacyPrivateKey
+		PublicKey  []byte
+	}
+
+	wallet := NewWallet()
+	address := string(wallet.GetAddress())
+	key := wallet.PrivateKey
+	legacy := struct {
+		Wallets map[string]*legacyWallet
+	}{map[string]*legacyWallet{
+		address: {legacyPrivateKey{legacyPublicKey{legacyCurve{"P-256"}, key.X, key.Y}, key.D}, wallet.PublicKey},
+	}}
+
+	gob.Register(legacyCurve{})
+	var content bytes.Buffer
+	err := gob.NewEncoder(&content).Encode(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(walletFile, content.Bytes(), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wallets, err := NewWallets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrated, err := wallets.GetWallet(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if migrated.PrivateKey.D.Cmp(key.D) != 0 || migrated.PrivateKey.X.Cmp(key.X) != 0 {
+		t.Error("the migrated key isn't the legacy one")
+	}
+
+	info, err := os.Stat(walletFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("migrated wallet file mode = %v, want 0600", info.Mode().Perm())
+	}
+	wallets, err = NewWallets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wallets.GetWallet(address); err != nil {
+		t.Errorf("reading the migrated file: %v", err)
+	}
+}
+
+func TestRestoreSeed(t *testing.T) {
+	defer useTestDir(t)()
+
+	wallets, _ := NewWallets()
+	mnemonic, err := wallets.NewSeed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wallets.NewSeed(); !errors.Is(err, ErrWalletHasSeed) {
+		t.Errorf("second seed: got %v, want %v", err, ErrWalletHasSeed)
+	}
+	var addresses []string
+	for i := 0; i < 30; i++ {
+		address, err := wallets.CreateWallet()
+		if err != nil {
+			t.Fatal(err)
+		}
+		addresses = append(addresses, address)
+	}
+	err = wallets.Encrypt("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = wallets.SaveToFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the seed is encrypted with the keys, and derives the next address once unlocked
+	wallets, _ = NewWallets()
+	if !wallets.HasSeed() {
+		t.Fatal("the wallet lost its seed")
+	}
+	err = wallets.Unlock("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, err := wallets.CreateWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next != string(hdAddressKey(wallets.seed, 30).Wallet().GetAddress()) {
+		t.Error("the reloaded wallet doesn't derive the address following the others")
+	}
+
+	// addresses 3 and 22 were used, the 18 unused ones between them are fewer than hdGapLimit
+	used := map[string]bool{addresses[3]: true, addresses[22]: true}
+	os.Remove(walletFile)
+	restored, _ := NewWallets()
+	got, err := restored.RestoreSeed(mnemonic, func(pubKeyHash []byte) bool {
+		return used[string(PubKeyHashToAddress(pubKeyHash))]
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 23 {
+		t.Fatalf("restored %d addresses, want 23", len(got))
+	}
+	for i, address := range got {
+		if address != addresses[i] {
+			t.Errorf("restored address %d = %s, want %s", i, address, addresses[i])
+		}
+	}
+	if address, _ := restored.CreateWallet(); address != addresses[23] {
+		t.Errorf("address after the restored ones = %s, want %s", address, addresses[23])
+	}
+}
+
+func TestImportWallet(t *testing.T) {
+	defer useTestDir(t)()
+
+	wallet := NewWallet()
+	wallets, _ := NewWallets()
+	address, err := wallets.ImportWallet(wallet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if address != string(wallet.GetAddress()) {
+		t.Errorf("imported address = %s, want %s", address, wallet.GetAddress())
+	}
+	err = wallets.Encrypt("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = wallets.SaveToFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the key is known even while the wallet is locked
+	wallets, _ = NewWallets()
+	if _, err := wallets.ImportWallet(wallet); !errors.Is(err, ErrKeyExists) {
+		t.Errorf("importing a key twice: got %v, want %v", err, ErrKeyExists)
+	}
+	if _, err := wallets.ImportWallet(NewWallet()); !errors.Is(err, ErrWalletLocked) {
+		t.Errorf("importing into a locked wallet: got %v, want %v", err, ErrWalletLocked)
+	}
+}
+
+func TestWatchOnlyAddresses(t *testing.T) {
+	defer useTestDir(t)()
+
+	cold := NewWallet()
+	customer := string(NewWallet().GetAddress())
+	wallets, _ := NewWallets()
+	coldAddress, err := wallets.WatchPublicKey(cold.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = wallets.WatchAddress(customer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wallets.WatchAddress(customer); !errors.Is(err, ErrAddressExists) {
+		t.Errorf("watching an address twice: got %v, want %v", err, ErrAddressExists)
+	}
+	if _, err := wallets.WatchPublicKey(cold.PublicKey[1:]); err == nil {
+		t.Error("watching a truncated public key succeeded")
+	}
+	err = wallets.SaveToFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wallets, _ = NewWallets()
+	if !wallets.IsWatchOnly(coldAddress) || !wallets.IsWatchOnly(customer) {
+		t.Error("the watch-only addresses are lost")
+	}
+	if len(wallets.GetAddresses()) != 0 || len(wallets.GetWatchOnlyAddresses()) != 2 {
+		t.Errorf("addresses = %v, watch-only addresses = %v", wallets.GetAddresses(), wallets.GetWatchOnlyAddresses())
+	}
+	if _, err := wallets.GetWallet(customer); !errors.Is(err, ErrWatchOnly) {
+		t.Errorf("key of a watch-only address: got %v, want %v", err, ErrWatchOnly)
+	}
+
+	// importing the key of a watched address makes it a full one
+	_, err = wallets.ImportWallet(cold)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wallets.IsWatchOnly(coldAddress) {
+		t.Error("the imported address is still watch-only")
+	}
+}